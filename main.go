@@ -1,33 +1,53 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	_ "embed"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"math"
+	"math/rand/v2"
 	"net"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	_ "time/tzdata" // DISPLAY_TZ must resolve in minimal containers
 )
 
 // ─── Configuration ──────────────────────────────────────────
 
 const (
 	apiURL            = "https://agsi.gie.eu/api"
-	country           = "DE"
+	defaultCountry    = "DE"
 	winterStartMD     = "11-01"
 	targetEndMD       = "04-30"
-	criticalThreshold = 10.0
+	defaultCritical   = 10.0 // percent full
 	trendWindow       = 14
+	minTrendWindow    = 3
+	maxTrendWindow    = 90
+	weekdayWindow     = 14
 	stressMultiplier  = 1.25
 	defaultPort       = "8080"
 	fetchSize         = 300
@@ -36,30 +56,788 @@ const (
 	retryDelay        = 2 * time.Second
 	delayBetweenCalls = 1 * time.Second
 	shutdownTimeout   = 5 * time.Second
+	defaultPprofAddr  = "localhost:6060"
+
+	defaultHistorySeasons     = 4
+	defaultStaleAfter         = 48 * time.Hour
+	defaultHistorySize        = 288 // 24h at 5-min resolution
+	defaultMaxGap             = 3   // max missing gas days to interpolate
+	defaultMaxProjectionDays  = 365
+	defaultEWMAAlpha          = 0.3
+	defaultHalfLife           = 7.0 // days, weighted regression decay
+	defaultPointStep          = 2.0 // days between projection points
+	minProjectionPoints       = 10
+	maxProjectionPoints       = 200
+	defaultRefreshInterval    = time.Minute
+	defaultAnomalySigma       = 2.5
+	minAnomalySamples         = 5
+	defaultDisplayTZ          = "Europe/Berlin" // AGSI gas-day reference zone
+	defaultBackoffBase        = 30 * time.Second
+	defaultBackoffMax         = 30 * time.Minute
+	defaultR2Threshold        = 0.5
+	defaultHandlerTimeout     = 90 * time.Second
+	maxRequestBody            = 64 << 10
+	defaultWarmWait           = 2 * time.Second
+	defaultTickStep           = 7
+	minDownsamplePoints       = 10
+	maxBatchPages             = 20
+	defaultChartWidth         = 1000
+	defaultChartHeight        = 500
+	minChartSize              = 200
+	maxChartSize              = 4000
+	defaultBuildTimeout       = 75 * time.Second // below defaultHandlerTimeout
+	defaultDrawdownPct        = 8.0
+	defaultDrawdownHysteresis = 2.0
+	maxStreamClients          = 100
+	streamHeartbeat           = 25 * time.Second
+	defaultFetchDelayMin      = 250 * time.Millisecond
+	defaultFetchDelayMax      = 10 * time.Second
+	latencyAlpha              = 0.3 // weight of the newest response time
+	defaultPivotRunDays       = 7
+	defaultMaxResponseBytes   = 8 << 20 // far above a full season (~150 KB)
+	minBandSeasons            = 2
+	defaultFillTolerance      = 0.5             // pct points beyond [0,100] clamped rather than rejected
+	defaultBuildShareWindow   = 5 * time.Second // a failed build is shared this long
+	defaultSummerStartMD      = "04-01"
+	defaultSummerEndMD        = "10-31"
+	defaultRefillTarget       = 90.0 // % full by the end of the injection season
+	defaultBaselineSeasons    = 5    // seasons in the multi-year average
+	defaultBreakerThreshold   = 5    // consecutive failed AGSI calls before failing fast
+	defaultBreakerCooldown    = 5 * time.Minute
+	defaultCacheTTL           = 2 * time.Hour
+	firstSeasonYear           = 2011 // AGSI coverage starts in 2011
+)
+
+// Build information, injected at build time:
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+var version, commit, buildTime string
+
+// ─── Environment ────────────────────────────────────────────
+
+// envParser reads typed settings for loadConfig. A malformed value
+// keeps the default and records an error, so that startup can report
+// every bad setting at once.
+type envParser struct{ errs []error }
+
+func (p *envParser) int(name string, dst *int) {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			*dst = n
+		} else {
+			p.errs = append(p.errs, fmt.Errorf("invalid %s %q", name, v))
+		}
+	}
+}
+
+func (p *envParser) float(name string, dst *float64) {
+	if v := os.Getenv(name); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			*dst = f
+		} else {
+			p.errs = append(p.errs, fmt.Errorf("invalid %s %q", name, v))
+		}
+	}
+}
+
+func (p *envParser) duration(name string, dst *time.Duration) {
+	if v := os.Getenv(name); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			*dst = d
+		} else {
+			p.errs = append(p.errs, fmt.Errorf("invalid %s %q", name, v))
+		}
+	}
+}
+
+// date reads a YYYY-MM-DD calendar day in loc.
+func (p *envParser) date(name string, loc *time.Location, dst *time.Time) {
+	if v := os.Getenv(name); v != "" {
+		if t, err := time.ParseInLocation("2006-01-02", v, loc); err == nil {
+			*dst = t
+		} else {
+			p.errs = append(p.errs, fmt.Errorf("invalid %s %q", name, v))
+		}
+	}
+}
+
+// ─── Logging ────────────────────────────────────────────────
+
+// plainLogTags maps the emoji used in log messages to ASCII tags, and
+// the box-drawing and arrow characters to their ASCII look-alikes.
+var plainLogTags = strings.NewReplacer(
+	"⚠️", "[WARN]", "❌", "[ERROR]", "✅", "[OK]", "🛑", "[STOP]",
+	"📡", "[FETCH]", "🔄", "[BUILD]", "📦", "[CACHE]", "♻️", "[CACHE]",
+	"📅", "[DATE]", "📌", "[DATE]", "⏳", "[WAIT]", "⏸️", "[WAIT]",
+	"⏭️", "[SKIP]", "📂", "[FILE]", "💾", "[FILE]", "📉", "[TREND]",
+	"📈", "[TREND]", "📊", "[KPI]", "❄️", "[STRESS]", "🚨", "[ALERT]",
+	"🔥", "[ALERT]", "🌱", "[SEED]", "🩹", "[FIX]", "🔀", "[PIVOT]",
+	"🔍", "[DEBUG]", "🩺", "[CHECK]", "🚀", "[START]", "🔒", "[TLS]",
+	"🔑", "[KEY]", "👋", "[BYE]", "🎯", "[TARGET]", "⚙️", "[CONFIG]", "🔌", "[BREAKER]",
+	"═", "=", "─", "-", "→", "->", "≥", ">=", "×", "x", "²", "2",
+	"·", "-", "–", "-", "—", "-", "…", "...", "σ", "sigma", "Δ", "delta",
 )
 
+// plainLogWriter rewrites log output with plainLogTags.
+type plainLogWriter struct{ w io.Writer }
+
+func (p plainLogWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(p.w, plainLogTags.Replace(string(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// setupLogging switches to ASCII-only log output with LOG_EMOJI=0,
+// for terminals and log viewers that mangle emoji.
+func setupLogging(plain bool) {
+	if plain {
+		log.SetOutput(plainLogWriter{os.Stderr})
+	}
+}
+
+// ─── Startup Config ─────────────────────────────────────────
+
+// Config holds every setting, resolved and validated once at startup
+// from flags and the environment, and is passed to the builds and
+// handlers that need them. Nothing else reads the environment.
+type Config struct {
+	Port          string   // PORT
+	StrictPort    bool     // STRICT_PORT=1: a busy port is fatal
+	FallbackPorts []string // FALLBACK_PORTS
+	BasePath      string   // BASE_PATH, normalized to "/prefix" or ""
+	CORSOrigins   []string // CORS_ORIGINS
+	TLSCert       string   // TLS_CERT
+	TLSKey        string   // TLS_KEY
+	Source        string   // AGSI_SOURCE: file://dir or an http(s) mirror
+	DataSource    string   // DATA_SOURCE
+	APIKey        string   // AGSI_API_KEY
+	UserAgent     string   // AGSI_USER_AGENT
+	Prefetch      bool     // PREFETCH, disabled with 0
+	Pprof         bool     // DEBUG_PPROF=1
+	PprofAddr     string   // DEBUG_PPROF_ADDR
+	PlainLogs     bool     // LOG_EMOJI=0
+	Check         bool     // -check or MODE=check
+	DumpPath      string   // -dump
+
+	Country           string         // COUNTRY, the AGSI aggregate
+	CacheTTL          time.Duration  // CACHE_TTL
+	Critical          float64        // CRITICAL_THRESHOLD, percent full
+	HistorySeasons    int            // HISTORY_SEASONS, prior seasons shown
+	MaxProjectionDays int            // MAX_PROJECTION_DAYS
+	BuildTimeout      time.Duration  // BUILD_TIMEOUT
+	HandlerTimeout    time.Duration  // HANDLER_TIMEOUT
+	BreakerThreshold  int            // BREAKER_THRESHOLD, 0 disables
+	BreakerCooldown   time.Duration  // BREAKER_COOLDOWN
+	BuildShareWindow  time.Duration  // BUILD_SHARE_WINDOW, 0 disables
+	Calendar          Calendar       // AS_OF, SEASON_MODE, TARGET_END_MD, WINTER_START, ...
+	DisplayLoc        *time.Location // DISPLAY_TZ
+	HistorySize       int            // SNAPSHOT_HISTORY_SIZE
+	RefreshBurst      int            // REFRESH_BURST
+	RefreshInterval   time.Duration  // REFRESH_INTERVAL
+	RefreshToken      string         // REFRESH_TOKEN, required by /api/refresh if set
+	BypassSecret      string         // BYPASS_CACHE_SECRET
+	WarmWait          time.Duration  // WARM_WAIT, how long /api/compare waits for a fetch
+	MaxResponseBytes  int            // MAX_RESPONSE_BYTES
+	FetchDelayMin     time.Duration  // FETCH_DELAY_MIN
+	FetchDelayMax     time.Duration  // FETCH_DELAY_MAX
+	BatchFetch        bool           // BATCH_FETCH=1
+	BackoffBase       time.Duration  // BUILD_BACKOFF_BASE
+	BackoffMax        time.Duration  // BUILD_BACKOFF_MAX
+	Records           RecordOptions  // MAX_INTERPOLATE_GAP, FILL_TOLERANCE, SEED_TREND, ...
+
+	Units              string    // UNITS: percent or twh
+	RefillTarget       float64   // REFILL_TARGET, percent full by the end of summer
+	StressMultipliers  []float64 // STRESS_MULTIPLIERS, ascending, each above 1
+	MinScenarioDays    int       // MIN_SCENARIO_DAYS, 0 for the full fit window
+	ProjectionOffset   int       // PROJECTION_OFFSET_DAYS
+	ProvisionalDays    int       // PROVISIONAL_DAYS
+	SeasonHorizon      bool      // PROJECTION_HORIZON=season
+	ProjectToSeasonEnd bool      // PROJECT_TO_SEASON_END=1
+	R2Threshold        float64   // R2_THRESHOLD, below it a fit is low confidence
+	PointStep          float64   // PROJECTION_POINT_STEP, days
+	DailySampling      bool      // PROJECTION_SAMPLING=daily
+	WeightedFit        bool      // REGRESSION=weighted
+	HalfLife           float64   // REGRESSION_HALF_LIFE, days
+
+	DrawdownPct        float64       // RAPID_DRAWDOWN_PCT, points over 7 days
+	DrawdownHysteresis float64       // RAPID_DRAWDOWN_HYSTERESIS
+	AlertWebhookURL    string        // ALERT_WEBHOOK_URL
+	StaleAfter         time.Duration // STALE_AFTER
+	BaselineSeasons    int           // BASELINE_SEASONS, 0 disables the baseline
+	SmoothWindow       int           // SMOOTH_WINDOW, odd; 0 disables smoothing
+	TickStep           int           // TICK_STEP_DAYS
+	Palette            palette       // SEASON_PALETTE
+	AnomalySigma       float64       // ANOMALY_SIGMA
+}
+
+// defaultConfig returns the settings used where neither a flag nor the
+// environment overrides them.
+func defaultConfig() Config {
+	return Config{
+		Port:          defaultPort,
+		FallbackPorts: defaultFallbackPorts,
+		UserAgent:     defaultUserAgent,
+		Prefetch:      true,
+		PprofAddr:     defaultPprofAddr,
+
+		Country:           defaultCountry,
+		CacheTTL:          defaultCacheTTL,
+		Critical:          defaultCritical,
+		HistorySeasons:    defaultHistorySeasons,
+		MaxProjectionDays: defaultMaxProjectionDays,
+		BuildTimeout:      defaultBuildTimeout,
+		HandlerTimeout:    defaultHandlerTimeout,
+		BreakerThreshold:  defaultBreakerThreshold,
+		BreakerCooldown:   defaultBreakerCooldown,
+		BuildShareWindow:  defaultBuildShareWindow,
+		Calendar: Calendar{
+			SummerStart:  defaultSummerStartMD,
+			SummerEnd:    defaultSummerEndMD,
+			TargetEnd:    targetEndMD,
+			YearMin:      firstSeasonYear,
+			PivotRunDays: defaultPivotRunDays,
+		},
+		DisplayLoc:       displayLoc,
+		HistorySize:      defaultHistorySize,
+		RefreshBurst:     1,
+		RefreshInterval:  defaultRefreshInterval,
+		WarmWait:         defaultWarmWait,
+		MaxResponseBytes: defaultMaxResponseBytes,
+		FetchDelayMin:    defaultFetchDelayMin,
+		FetchDelayMax:    defaultFetchDelayMax,
+		BackoffBase:      defaultBackoffBase,
+		BackoffMax:       defaultBackoffMax,
+		Records: RecordOptions{
+			MaxGap:        defaultMaxGap,
+			FillTolerance: defaultFillTolerance,
+			EWMAAlpha:     defaultEWMAAlpha,
+		},
+
+		Units:             unitsPercent,
+		RefillTarget:      defaultRefillTarget,
+		StressMultipliers: []float64{stressMultiplier},
+		R2Threshold:       defaultR2Threshold,
+		PointStep:         defaultPointStep,
+		HalfLife:          defaultHalfLife,
+
+		DrawdownPct:        defaultDrawdownPct,
+		DrawdownHysteresis: defaultDrawdownHysteresis,
+		StaleAfter:         defaultStaleAfter,
+		BaselineSeasons:    defaultBaselineSeasons,
+		TickStep:           defaultTickStep,
+		Palette:            palettes["default"],
+		AnomalySigma:       defaultAnomalySigma,
+	}
+}
+
+// loadConfig parses the command line and reads the environment. The
+// returned error lists every invalid setting, not just the first.
+func loadConfig() (Config, error) {
+	c := defaultConfig()
+	c.StrictPort = os.Getenv("STRICT_PORT") == "1"
+	c.BasePath = normalizeBasePath(os.Getenv("BASE_PATH"))
+	c.CORSOrigins = splitList(os.Getenv("CORS_ORIGINS"))
+	c.TLSCert, c.TLSKey = os.Getenv("TLS_CERT"), os.Getenv("TLS_KEY")
+	c.Source, c.DataSource = os.Getenv("AGSI_SOURCE"), os.Getenv("DATA_SOURCE")
+	c.APIKey = os.Getenv("AGSI_API_KEY")
+	c.Prefetch = os.Getenv("PREFETCH") != "0"
+	c.Pprof = os.Getenv("DEBUG_PPROF") == "1"
+	c.PlainLogs = os.Getenv("LOG_EMOJI") == "0"
+	c.RefreshToken = os.Getenv("REFRESH_TOKEN")
+	c.BypassSecret = os.Getenv("BYPASS_CACHE_SECRET")
+	c.BatchFetch = os.Getenv("BATCH_FETCH") == "1"
+	c.Records.SeedTrend = os.Getenv("SEED_TREND") == "1"
+	c.ProjectToSeasonEnd = os.Getenv("PROJECT_TO_SEASON_END") == "1"
+	c.AlertWebhookURL = os.Getenv("ALERT_WEBHOOK_URL")
+	if p := os.Getenv("PORT"); p != "" {
+		c.Port = p
+	}
+	if v, ok := os.LookupEnv("FALLBACK_PORTS"); ok {
+		c.FallbackPorts = splitList(v)
+	}
+	if ua := os.Getenv("AGSI_USER_AGENT"); ua != "" {
+		c.UserAgent = ua
+	}
+	if addr := os.Getenv("DEBUG_PPROF_ADDR"); addr != "" {
+		c.PprofAddr = addr
+	}
+	if v := os.Getenv("COUNTRY"); v != "" {
+		c.Country = strings.ToUpper(v)
+	}
+	var p envParser
+	p.duration("CACHE_TTL", &c.CacheTTL)
+	p.float("CRITICAL_THRESHOLD", &c.Critical)
+	p.int("HISTORY_SEASONS", &c.HistorySeasons)
+	p.int("MAX_PROJECTION_DAYS", &c.MaxProjectionDays)
+	p.duration("BUILD_TIMEOUT", &c.BuildTimeout)
+	p.duration("HANDLER_TIMEOUT", &c.HandlerTimeout)
+	p.int("BREAKER_THRESHOLD", &c.BreakerThreshold)
+	p.duration("BREAKER_COOLDOWN", &c.BreakerCooldown)
+	p.duration("BUILD_SHARE_WINDOW", &c.BuildShareWindow)
+	p.int("SNAPSHOT_HISTORY_SIZE", &c.HistorySize)
+	p.int("REFRESH_BURST", &c.RefreshBurst)
+	p.duration("REFRESH_INTERVAL", &c.RefreshInterval)
+	p.duration("WARM_WAIT", &c.WarmWait)
+	p.int("MAX_RESPONSE_BYTES", &c.MaxResponseBytes)
+	p.duration("FETCH_DELAY_MIN", &c.FetchDelayMin)
+	p.duration("FETCH_DELAY_MAX", &c.FetchDelayMax)
+	p.duration("BUILD_BACKOFF_BASE", &c.BackoffBase)
+	p.duration("BUILD_BACKOFF_MAX", &c.BackoffMax)
+	p.int("MAX_INTERPOLATE_GAP", &c.Records.MaxGap)
+	p.float("FILL_TOLERANCE", &c.Records.FillTolerance)
+	p.float("EWMA_ALPHA", &c.Records.EWMAAlpha)
+	switch v := os.Getenv("TREND_DAYS"); v {
+	case "", "calendar":
+	case "business":
+		c.Records.BusinessDays = true
+	default:
+		p.errs = append(p.errs, fmt.Errorf("unknown TREND_DAYS %q", v))
+	}
+	if v := os.Getenv("DISPLAY_TZ"); v != "" {
+		if loc, err := time.LoadLocation(v); err == nil {
+			c.DisplayLoc = loc
+		} else {
+			p.errs = append(p.errs, fmt.Errorf("unknown DISPLAY_TZ %q", v))
+		}
+	}
+	p.date("AS_OF", c.DisplayLoc, &c.Calendar.AsOf)
+	switch v := os.Getenv("SEASON_MODE"); v {
+	case "", "winter":
+	case "summer":
+		c.Calendar.Summer = true
+	default:
+		p.errs = append(p.errs, fmt.Errorf("unknown SEASON_MODE %q", v))
+	}
+	if v := os.Getenv("SUMMER_START_MD"); v != "" {
+		c.Calendar.SummerStart = v
+	}
+	if v := os.Getenv("SUMMER_END_MD"); v != "" {
+		c.Calendar.SummerEnd = v
+	}
+	if v := os.Getenv("TARGET_END_MD"); v != "" {
+		c.Calendar.TargetEnd = v
+	}
+	p.int("SEASON_YEAR_MIN", &c.Calendar.YearMin)
+	p.int("SEASON_YEAR_MAX", &c.Calendar.YearMax)
+	switch v := os.Getenv("WINTER_START"); v {
+	case "", "calendar":
+	case "detect":
+		c.Calendar.DetectStart = true
+	default:
+		p.errs = append(p.errs, fmt.Errorf("unknown WINTER_START %q", v))
+	}
+	p.int("PIVOT_RUN_DAYS", &c.Calendar.PivotRunDays)
+	switch v := os.Getenv("UNITS"); strings.ToLower(v) {
+	case "", unitsPercent:
+	case unitsTWh:
+		c.Units = unitsTWh
+	default:
+		p.errs = append(p.errs, fmt.Errorf("unknown UNITS %q", v))
+	}
+	p.float("REFILL_TARGET", &c.RefillTarget)
+	if v := os.Getenv("STRESS_MULTIPLIERS"); v != "" {
+		c.StressMultipliers = nil
+		for _, s := range splitList(v) {
+			if m, err := strconv.ParseFloat(s, 64); err == nil {
+				c.StressMultipliers = append(c.StressMultipliers, m)
+			} else {
+				p.errs = append(p.errs, fmt.Errorf("invalid STRESS_MULTIPLIERS value %q", s))
+			}
+		}
+		sort.Float64s(c.StressMultipliers)
+	}
+	p.int("MIN_SCENARIO_DAYS", &c.MinScenarioDays)
+	p.int("PROJECTION_OFFSET_DAYS", &c.ProjectionOffset)
+	p.int("PROVISIONAL_DAYS", &c.ProvisionalDays)
+	switch v := os.Getenv("PROJECTION_HORIZON"); v {
+	case "", "days":
+	case "season":
+		c.SeasonHorizon = true
+	default:
+		p.errs = append(p.errs, fmt.Errorf("unknown PROJECTION_HORIZON %q", v))
+	}
+	p.float("R2_THRESHOLD", &c.R2Threshold)
+	p.float("PROJECTION_POINT_STEP", &c.PointStep)
+	switch v := os.Getenv("PROJECTION_SAMPLING"); v {
+	case "", "even":
+	case "daily":
+		c.DailySampling = true
+	default:
+		p.errs = append(p.errs, fmt.Errorf("unknown PROJECTION_SAMPLING %q", v))
+	}
+	switch v := os.Getenv("REGRESSION"); v {
+	case "", "linear":
+	case "weighted":
+		c.WeightedFit = true
+	default:
+		p.errs = append(p.errs, fmt.Errorf("unknown REGRESSION %q", v))
+	}
+	p.float("REGRESSION_HALF_LIFE", &c.HalfLife)
+	p.float("RAPID_DRAWDOWN_PCT", &c.DrawdownPct)
+	p.float("RAPID_DRAWDOWN_HYSTERESIS", &c.DrawdownHysteresis)
+	p.duration("STALE_AFTER", &c.StaleAfter)
+	p.int("BASELINE_SEASONS", &c.BaselineSeasons)
+	p.int("SMOOTH_WINDOW", &c.SmoothWindow)
+	p.int("TICK_STEP_DAYS", &c.TickStep)
+	if v := strings.TrimSpace(os.Getenv("SEASON_PALETTE")); v != "" {
+		if pal, err := parsePalette(v); err == nil {
+			c.Palette = pal
+		} else {
+			p.errs = append(p.errs, err)
+		}
+	}
+	p.float("ANOMALY_SIGMA", &c.AnomalySigma)
+
+	flag.BoolVar(&c.Check, "check", os.Getenv("MODE") == "check",
+		"build the dashboard once, print the KPIs and exit")
+	flag.StringVar(&c.DumpPath, "dump", "",
+		"write each built dashboard as JSON to this `file`")
+	flag.Parse()
+
+	return c, errors.Join(append(p.errs, c.validate())...)
+}
+
+// validate reports settings that would otherwise fail late or be
+// silently ignored.
+func (c Config) validate() error {
+	var errs []error
+	for _, p := range append([]string{c.Port}, c.FallbackPorts...) {
+		if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+			errs = append(errs, fmt.Errorf("invalid port %q", p))
+		}
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		errs = append(errs, errors.New("TLS_CERT and TLS_KEY must be set together"))
+	}
+	if c.Source != "" && !strings.HasPrefix(c.Source, "file://") &&
+		!strings.HasPrefix(c.Source, "http://") && !strings.HasPrefix(c.Source, "https://") {
+		errs = append(errs, fmt.Errorf("AGSI_SOURCE %q is neither file:// nor http(s)://", c.Source))
+	}
+	if _, ok := dataSources[c.DataSource]; c.DataSource != "" && !ok {
+		errs = append(errs, fmt.Errorf("unknown DATA_SOURCE %q", c.DataSource))
+	}
+	if len(c.Country) != 2 || strings.Trim(c.Country, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		errs = append(errs, fmt.Errorf("COUNTRY %q is not a two-letter country code", c.Country))
+	}
+	if c.CacheTTL <= 0 {
+		errs = append(errs, fmt.Errorf("CACHE_TTL %s must be positive", c.CacheTTL))
+	}
+	if c.Critical <= 0 || c.Critical >= 100 {
+		errs = append(errs, fmt.Errorf("CRITICAL_THRESHOLD %g must be between 0 and 100", c.Critical))
+	}
+	if c.HistorySeasons < 0 {
+		errs = append(errs, fmt.Errorf("HISTORY_SEASONS %d is negative", c.HistorySeasons))
+	}
+	if c.MaxProjectionDays < 1 {
+		errs = append(errs, fmt.Errorf("MAX_PROJECTION_DAYS %d must be at least 1", c.MaxProjectionDays))
+	}
+	if c.BreakerThreshold < 0 {
+		errs = append(errs, fmt.Errorf("BREAKER_THRESHOLD %d is negative", c.BreakerThreshold))
+	}
+	if c.BreakerCooldown <= 0 {
+		errs = append(errs, fmt.Errorf("BREAKER_COOLDOWN %s must be positive", c.BreakerCooldown))
+	}
+	if c.BuildShareWindow < 0 {
+		errs = append(errs, fmt.Errorf("BUILD_SHARE_WINDOW %s is negative", c.BuildShareWindow))
+	}
+	// A build outliving HANDLER_TIMEOUT would answer with a bare 503
+	// instead of the BUILD_TIMEOUT error and its retry hint.
+	if c.BuildTimeout <= 0 || c.BuildTimeout >= c.HandlerTimeout {
+		errs = append(errs, fmt.Errorf("BUILD_TIMEOUT %s must be positive and below HANDLER_TIMEOUT %s",
+			c.BuildTimeout, c.HandlerTimeout))
+	}
+	if c.HistorySize < 1 {
+		errs = append(errs, fmt.Errorf("SNAPSHOT_HISTORY_SIZE %d must be at least 1", c.HistorySize))
+	}
+	if c.RefreshBurst < 1 {
+		errs = append(errs, fmt.Errorf("REFRESH_BURST %d must be at least 1", c.RefreshBurst))
+	}
+	if c.RefreshInterval <= 0 {
+		errs = append(errs, fmt.Errorf("REFRESH_INTERVAL %s must be positive", c.RefreshInterval))
+	}
+	if c.WarmWait <= 0 {
+		errs = append(errs, fmt.Errorf("WARM_WAIT %s must be positive", c.WarmWait))
+	}
+	if c.MaxResponseBytes <= 0 {
+		errs = append(errs, fmt.Errorf("MAX_RESPONSE_BYTES %d must be positive", c.MaxResponseBytes))
+	}
+	if c.FetchDelayMin <= 0 || c.FetchDelayMax < c.FetchDelayMin {
+		errs = append(errs, fmt.Errorf("FETCH_DELAY_MIN %s must be positive and at most FETCH_DELAY_MAX %s",
+			c.FetchDelayMin, c.FetchDelayMax))
+	}
+	if c.BackoffBase <= 0 || c.BackoffMax < c.BackoffBase {
+		errs = append(errs, fmt.Errorf("BUILD_BACKOFF_BASE %s must be positive and at most BUILD_BACKOFF_MAX %s",
+			c.BackoffBase, c.BackoffMax))
+	}
+	if c.Records.MaxGap < 0 {
+		errs = append(errs, fmt.Errorf("MAX_INTERPOLATE_GAP %d is negative", c.Records.MaxGap))
+	}
+	if tol := c.Records.FillTolerance; tol < 0 || math.IsNaN(tol) {
+		errs = append(errs, fmt.Errorf("FILL_TOLERANCE %g must be a non-negative number", tol))
+	}
+	if a := c.Records.EWMAAlpha; !(a > 0 && a <= 1) {
+		errs = append(errs, fmt.Errorf("EWMA_ALPHA %g must lie in (0, 1]", a))
+	}
+	if start, end := c.Calendar.SummerStart, c.Calendar.SummerEnd; !validMonthDay(start) ||
+		!validMonthDay(end) || start >= end {
+		errs = append(errs, fmt.Errorf("SUMMER_START_MD %q and SUMMER_END_MD %q must be MM-DD with start before end",
+			start, end))
+	}
+	// Feb 29 is rejected since most years don't have it.
+	if end := c.Calendar.TargetEnd; !validMonthDay(end) || end >= winterStartMD {
+		errs = append(errs, fmt.Errorf("TARGET_END_MD %q must be MM-DD before %s", end, winterStartMD))
+	}
+	if cal := c.Calendar; cal.YearMax != 0 && cal.YearMax < cal.YearMin {
+		errs = append(errs, fmt.Errorf("SEASON_YEAR_MAX %d is before SEASON_YEAR_MIN %d", cal.YearMax, cal.YearMin))
+	}
+	if c.Calendar.PivotRunDays < 1 {
+		errs = append(errs, fmt.Errorf("PIVOT_RUN_DAYS %d must be at least 1", c.Calendar.PivotRunDays))
+	}
+	if t := c.RefillTarget; !(t > 0 && t <= 100) {
+		errs = append(errs, fmt.Errorf("REFILL_TARGET %g must be above 0 and at most 100", t))
+	}
+	if len(c.StressMultipliers) == 0 {
+		errs = append(errs, errors.New("STRESS_MULTIPLIERS needs at least one value"))
+	}
+	for _, m := range c.StressMultipliers {
+		if !(m > 1) {
+			errs = append(errs, fmt.Errorf("STRESS_MULTIPLIERS value %g must be above 1", m))
+		}
+	}
+	if n := c.MinScenarioDays; n != 0 && n < minTrendWindow {
+		errs = append(errs, fmt.Errorf("MIN_SCENARIO_DAYS %d must be 0 or at least %d", n, minTrendWindow))
+	}
+	if c.ProjectionOffset < 0 {
+		errs = append(errs, fmt.Errorf("PROJECTION_OFFSET_DAYS %d is negative", c.ProjectionOffset))
+	}
+	if c.ProvisionalDays < 0 {
+		errs = append(errs, fmt.Errorf("PROVISIONAL_DAYS %d is negative", c.ProvisionalDays))
+	}
+	if t := c.R2Threshold; !(t >= 0 && t <= 1) {
+		errs = append(errs, fmt.Errorf("R2_THRESHOLD %g must lie in [0, 1]", t))
+	}
+	if !(c.PointStep > 0) {
+		errs = append(errs, fmt.Errorf("PROJECTION_POINT_STEP %g must be positive", c.PointStep))
+	}
+	if !(c.HalfLife > 0) {
+		errs = append(errs, fmt.Errorf("REGRESSION_HALF_LIFE %g must be positive", c.HalfLife))
+	}
+	if !(c.DrawdownPct > 0) {
+		errs = append(errs, fmt.Errorf("RAPID_DRAWDOWN_PCT %g must be positive", c.DrawdownPct))
+	}
+	if !(c.DrawdownHysteresis >= 0) {
+		errs = append(errs, fmt.Errorf("RAPID_DRAWDOWN_HYSTERESIS %g is negative", c.DrawdownHysteresis))
+	}
+	if u := c.AlertWebhookURL; u != "" && !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		errs = append(errs, fmt.Errorf("ALERT_WEBHOOK_URL %q is not an http(s):// URL", u))
+	}
+	if c.StaleAfter <= 0 {
+		errs = append(errs, fmt.Errorf("STALE_AFTER %s must be positive", c.StaleAfter))
+	}
+	if c.BaselineSeasons < 0 {
+		errs = append(errs, fmt.Errorf("BASELINE_SEASONS %d is negative", c.BaselineSeasons))
+	}
+	if n := c.SmoothWindow; n != 0 && (n < 3 || n%2 == 0) {
+		errs = append(errs, fmt.Errorf("SMOOTH_WINDOW %d must be 0 or an odd number ≥ 3", n))
+	}
+	if c.TickStep < 1 {
+		errs = append(errs, fmt.Errorf("TICK_STEP_DAYS %d must be at least 1", c.TickStep))
+	}
+	if !(c.AnomalySigma > 0) {
+		errs = append(errs, fmt.Errorf("ANOMALY_SIGMA %g must be positive", c.AnomalySigma))
+	}
+	return errors.Join(errs...)
+}
+
+// validMonthDay reports whether md is an MM-DD day found in every
+// year.
+func validMonthDay(md string) bool {
+	_, err := time.Parse("01-02", md)
+	return err == nil && md != "02-29"
+}
+
+// useTLS reports whether the server should listen with TLS.
+func (c Config) useTLS() bool { return c.TLSCert != "" && c.TLSKey != "" }
+
+// fixtureDir reports the directory configured via
+// AGSI_SOURCE=file:///path when running against saved responses.
+func (c Config) fixtureDir() (string, bool) {
+	if !strings.HasPrefix(c.Source, "file://") {
+		return "", false
+	}
+	return strings.TrimPrefix(c.Source, "file://"), true
+}
+
+// apiBaseURL returns the AGSI endpoint, overridable with
+// AGSI_SOURCE=http(s)://... to point at a mirror or a mock server.
+func (c Config) apiBaseURL() string {
+	if strings.HasPrefix(c.Source, "http://") || strings.HasPrefix(c.Source, "https://") {
+		return c.Source
+	}
+	return apiURL
+}
+
+// logConfig prints the resolved settings once at startup, with the
+// API key masked.
+func logConfig(c Config) {
+	key := "not set"
+	if c.APIKey != "" {
+		key = "set"
+	}
+	cors := "same-origin"
+	if len(c.CORSOrigins) > 0 {
+		cors = strings.Join(c.CORSOrigins, ", ")
+	}
+	log.Println("  ⚙️  Config:")
+	log.Printf("     Port      : %s (strict %t, fallbacks %s)", c.Port, c.StrictPort, strings.Join(c.FallbackPorts, ","))
+	log.Printf("     Base path : %q", c.BasePath)
+	log.Printf("     CORS      : %s", cors)
+	log.Printf("     TLS       : %t", c.useTLS())
+	log.Printf("     Source    : %s", activeSource.Name())
+	log.Printf("     API key   : %s", key)
+	log.Printf("     Prefetch  : %t", c.Prefetch)
+	log.Printf("     pprof     : %t", c.Pprof)
+	log.Printf("     Country   : %s", c.Country)
+	log.Printf("     Cache TTL : %s", c.CacheTTL)
+	log.Printf("     Analysis  : critical %g%%, %d prior seasons, %d-day horizon",
+		c.Critical, c.HistorySeasons, c.MaxProjectionDays)
+	if c.Calendar.Summer {
+		log.Printf("     Season    : summer %s to %s", c.Calendar.SummerStart, c.Calendar.SummerEnd)
+	}
+	if c.Calendar.Pinned() {
+		log.Printf("     As of     : %s", c.Calendar.AsOf.Format("2006-01-02"))
+	}
+	if c.DumpPath != "" {
+		log.Printf("     Dump      : %s", c.DumpPath)
+	}
+}
+
+// ─── Errors ─────────────────────────────────────────────────
+
+// ErrEmptyData means AGSI answered but had no records for the season.
+var ErrEmptyData = errors.New("no data")
+
+// ErrSeasonRange means a season year outside Calendar.YearRange was
+// requested.
+var ErrSeasonRange = errors.New("season out of range")
+
+// ErrBackingOff means builds are paused after repeated failures.
+var ErrBackingOff = errors.New("backing off after repeated build failures")
+
+// ErrCircuitOpen means AGSI calls are paused by agsiBreaker after
+// repeated failures. It is not retried.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// ErrMaintenance means AGSI answered with an HTML page where JSON was
+// expected, as it does during maintenance. It is retried.
+var ErrMaintenance = errors.New("upstream returned HTML instead of JSON")
+
+// ErrTooLarge means an AGSI response exceeded MAX_RESPONSE_BYTES.
+var ErrTooLarge = errors.New("response too large")
+
+// ErrTruncated means an AGSI response body ended mid-document, e.g.
+// after a connection reset. Unlike a ParseError it is retried.
+var ErrTruncated = errors.New("truncated response")
+
+// APIStatusError is a non-200 response from AGSI.
+type APIStatusError struct {
+	Code int
+	Body string // first 500 bytes
+}
+
+func (e *APIStatusError) Error() string {
+	return fmt.Sprintf("API status %d: %s", e.Code, e.Body)
+}
+
+// ParseError is an AGSI response that could not be decoded into
+// records.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string { return "parsing response: " + e.Err.Error() }
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// retryable reports whether fetching again may help: network errors,
+// throttling and server errors. Bad requests, empty seasons, parse
+// failures and missing fixtures won't change on retry.
+func retryable(err error) bool {
+	var status *APIStatusError
+	var parse *ParseError
+	switch {
+	case errors.Is(err, ErrEmptyData), errors.Is(err, ErrSeasonRange),
+		errors.Is(err, os.ErrNotExist), errors.As(err, &parse), errors.Is(err, ErrTooLarge),
+		errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, ErrCircuitOpen):
+		return false
+	case errors.As(err, &status):
+		return status.Code == http.StatusTooManyRequests || status.Code >= 500
+	}
+	return true
+}
+
+// buildErrorStatus maps a build error to the HTTP status and hint
+// served to clients.
+func buildErrorStatus(err error) (int, string) {
+	var status *APIStatusError
+	var parse *ParseError
+	switch {
+	case errors.As(err, &status) && (status.Code == http.StatusUnauthorized || status.Code == http.StatusForbidden):
+		return http.StatusBadGateway, "Set AGSI_API_KEY env var if API requires auth."
+	case errors.As(err, &status), errors.As(err, &parse),
+		errors.Is(err, ErrTruncated), errors.Is(err, ErrTooLarge):
+		return http.StatusBadGateway, "AGSI returned an unexpected response, try again later."
+	case errors.Is(err, ErrEmptyData):
+		return http.StatusServiceUnavailable, "AGSI has no data for the configured seasons yet."
+	case errors.Is(err, ErrMaintenance):
+		return http.StatusServiceUnavailable, "AGSI appears to be down for maintenance, try again later."
+	case errors.Is(err, ErrBackingOff):
+		return http.StatusServiceUnavailable, "The next build is attempted automatically once the backoff expires."
+	case errors.Is(err, ErrCircuitOpen):
+		return http.StatusServiceUnavailable, "AGSI keeps failing; calls resume after BREAKER_COOLDOWN."
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "The build exceeded BUILD_TIMEOUT; seasons already loaded are cached for the next attempt."
+	}
+	return http.StatusInternalServerError, "See the server log for details."
+}
+
 // ─── Data Models ────────────────────────────────────────────
 
 type APIResponse struct {
-	Data []APIRecord `json:"data"`
+	LastPage int         `json:"last_page"`
+	Data     []APIRecord `json:"data"`
 }
 
 type APIRecord struct {
-	GasDayStart string `json:"gasDayStart"`
-	Full        string `json:"full"`
-	Injection   string `json:"injection"`
-	Withdrawal  string `json:"withdrawal"`
+	GasDayStart      string `json:"gasDayStart"`
+	Full             string `json:"full"`
+	Injection        string `json:"injection"`
+	Withdrawal       string `json:"withdrawal"`
+	GasInStorage     string `json:"gasInStorage"`
+	WorkingGasVolume string `json:"workingGasVolume"`
+	Name             string `json:"name"`
 }
 
 type DayRecord struct {
-	Date        time.Time `json:"date"`
-	DateStr     string    `json:"dateStr"`
-	Full        float64   `json:"full"`
-	Injection   float64   `json:"injection"`
-	Withdrawal  float64   `json:"withdrawal"`
-	DaysElapsed int       `json:"daysElapsed"`
-	Trend       float64   `json:"trend"`
-	TrendMA7    float64   `json:"trendMa7"`
+	Date             time.Time `json:"date"`
+	DateStr          string    `json:"dateStr"`
+	Full             float64   `json:"full"`
+	Injection        float64   `json:"injection"`
+	Withdrawal       float64   `json:"withdrawal"`
+	NetFlow          float64   `json:"netFlow"`      // injection − withdrawal, GWh/d
+	CumNetFlow       float64   `json:"cumNetFlow"`   // NetFlow summed from winter start, GWh
+	GasInStorage     float64   `json:"gasInStorage"` // TWh, 0 if absent
+	WorkingGasVolume float64   `json:"workingGasVolume"`
+	DaysElapsed      int       `json:"daysElapsed"`
+	Trend            float64   `json:"trend"`
+	TrendMA7         float64   `json:"trendMa7"`
+	TrendEWMA        float64   `json:"trendEwma"`
+	Interpolated     bool      `json:"interpolated,omitempty"`
+	Anomaly          bool      `json:"anomaly,omitempty"`
+	Facility         string    `json:"facility,omitempty"`    // set when drilling into a facility
+	Seeded           bool      `json:"seeded,omitempty"`      // trend uses pre-season seed data
+	Provisional      bool      `json:"provisional,omitempty"` // excluded from analysis, see PROVISIONAL_DAYS
 }
 
 type SeasonConfig struct {
@@ -75,6 +853,14 @@ type SeasonConfig struct {
 type SeasonData struct {
 	Config  SeasonConfig `json:"config"`
 	Records []DayRecord  `json:"records"`
+	Stats   SeasonStats  `json:"stats"`
+	// Smoothed is a centered moving average of Records' fill, aligned
+	// index by index, for display only (see SMOOTH_WINDOW). Scenarios
+	// and KPIs always use the raw values.
+	Smoothed []float64 `json:"smoothed,omitempty"`
+	// AnchorDate is the detected pivot the season's DaysElapsed count
+	// from when WINTER_START=detect.
+	AnchorDate string `json:"anchorDate,omitempty"`
 }
 
 type ScenarioPoint struct {
@@ -91,7 +877,22 @@ type Scenario struct {
 	Points   []ScenarioPoint `json:"points"`
 	HitDate  string          `json:"hitDate,omitempty"`
 	Slope    float64         `json:"slope,omitempty"`
-	DaysLeft int             `json:"daysLeft,omitempty"`
+	DaysLeft int             `json:"daysLeft,omitempty"` // counted from Origin
+	// R2 is the fit quality of the regression behind the projection;
+	// LowConfidence is set when it falls below R2_THRESHOLD.
+	R2            float64 `json:"r2,omitempty"`
+	LowConfidence bool    `json:"lowConfidence,omitempty"`
+	// Multiplier is the slope factor of a Stress scenario.
+	Multiplier float64 `json:"multiplier,omitempty"`
+	// Origin is the gas day the projection starts from; earlier than
+	// the last record when PROJECTION_OFFSET_DAYS is set.
+	Origin string `json:"origin,omitempty"`
+	// EndOfSeasonFill is the projected fill at the target end date,
+	// nil when the projection doesn't reach it.
+	EndOfSeasonFill *float64 `json:"endOfSeasonFill,omitempty"`
+	// SurvivesSeason is set when the projection is drawn up to the
+	// target end date without reaching the critical level.
+	SurvivesSeason bool `json:"survivesSeason,omitempty"`
 }
 
 type KPIData struct {
@@ -99,17 +900,301 @@ type KPIData struct {
 	CurrentDate   string  `json:"currentDate"`
 	Delta7D       float64 `json:"delta7d"`
 	AvgWithdrawal float64 `json:"avgWithdrawal"`
-	DaysToCrit    int     `json:"daysToCrit"`
+	// AvgWithdrawalWeekday averages Mon–Fri only over the last
+	// weekdayWindow days; weekend demand is structurally lower.
+	AvgWithdrawalWeekday float64 `json:"avgWithdrawalWeekday"`
+	DaysToCrit           int     `json:"daysToCrit"`
+	DaysToCritHistorical int     `json:"daysToCritHistorical"`
+	// DaysToCritWithdrawal divides the headroom above the critical level
+	// by the 7-day average withdrawal, independent of the fill slope.
+	DaysToCritWithdrawal int `json:"daysToCritWithdrawal"`
+	// DaysToTarget is the days until the refill target at the current
+	// trend, in summer mode (see refillScenarios).
+	DaysToTarget       int     `json:"daysToTarget"`
+	DaysToEmpty        int     `json:"daysToEmpty"`
+	DataAgeHours       float64 `json:"dataAgeHours"`
+	Stale              bool    `json:"stale"`
+	Anomalies          int     `json:"anomalies"`
+	TrendR2            float64 `json:"trendR2"`
+	TrendLowConfidence bool    `json:"trendLowConfidence"`
+	// CurrentFillTWh and Delta7DTWh give the absolute volume regardless
+	// of UNITS, so clients can switch units without another request.
+	// They stay 0 with TWhAvailable false when AGSI has no volumes.
+	CurrentFillTWh float64 `json:"currentFillTwh"`
+	Delta7DTWh     float64 `json:"delta7dTwh"`
+	TWhAvailable   bool    `json:"twhAvailable"`
+	// RapidDrawdown flags a 7-day fill drop beyond RAPID_DRAWDOWN_PCT
+	// percentage points (see DrawdownAlert).
+	RapidDrawdown bool `json:"rapidDrawdown"`
+	// SurvivesSeason is set when the linear trend stays above the
+	// critical level through the target end date; DaysToCrit is 999.
+	SurvivesSeason bool `json:"survivesSeason,omitempty"`
+}
+
+// SeasonDelta compares the current fill against a historical
+// season at the same DaysElapsed.
+type SeasonDelta struct {
+	Year     int     `json:"year"`
+	Name     string  `json:"name"`
+	DeltaPct float64 `json:"deltaPct"`
 }
 
 type DashboardData struct {
-	Seasons     []SeasonData `json:"seasons"`
-	Scenarios   []Scenario   `json:"scenarios"`
-	KPI         KPIData      `json:"kpi"`
-	TickVals    []int        `json:"tickVals"`
-	TickLabels  []string     `json:"tickLabels"`
-	GeneratedAt string       `json:"generatedAt"`
-	CurrentYear int          `json:"currentYear"`
+	Seasons      []SeasonData  `json:"seasons"`
+	Scenarios    []Scenario    `json:"scenarios"`
+	KPI          KPIData       `json:"kpi"`
+	SeasonDeltas []SeasonDelta `json:"seasonDeltas"`
+	TickVals     []int         `json:"tickVals"`
+	TickLabels   []string      `json:"tickLabels"`
+	GeneratedAt  string        `json:"generatedAt"`
+	CurrentYear  int           `json:"currentYear"`
+	Units        string        `json:"units"`
+	SeasonDays   int           `json:"seasonDays"`
+	Critical     float64       `json:"criticalThreshold"`      // percent full, see CRITICAL_THRESHOLD
+	ScenarioNote string        `json:"scenarioNote,omitempty"` // why Scenarios is empty
+	Bands        []BandPoint   `json:"bands,omitempty"`        // historical percentile envelope
+	Baseline     []BaselineDay `json:"baseline,omitempty"`     // multi-season average fill
+	Provisional  []string      `json:"provisional,omitempty"`  // gas days left out of trend, scenarios and KPIs
+	AsOf         string        `json:"asOf,omitempty"`         // date pinned with AS_OF
+	SeasonMode   string        `json:"seasonMode"`             // "winter" or "summer"
+	RefillTarget float64       `json:"refillTarget,omitempty"` // summer mode only
+	Warnings     []string      `json:"warnings,omitempty"`
+	StaleReason  string        `json:"staleReason,omitempty"` // set when serving last good data
+	Facility     string        `json:"facility,omitempty"`
+}
+
+// lastRecord returns the latest record of the current season.
+func (d *DashboardData) lastRecord() (DayRecord, bool) {
+	records := d.currentRecords()
+	if len(records) == 0 {
+		return DayRecord{}, false
+	}
+	return records[len(records)-1], true
+}
+
+// currentRecords returns the records of the season marked current.
+func (d *DashboardData) currentRecords() []DayRecord {
+	for _, s := range d.Seasons {
+		if s.Config.IsCurrent {
+			return s.Records
+		}
+	}
+	return nil
+}
+
+// analysisRecords returns the current season without its trailing
+// provisional days (see PROVISIONAL_DAYS).
+func (d *DashboardData) analysisRecords() []DayRecord {
+	records := d.currentRecords()
+	n := len(records)
+	for n > 1 && records[n-1].Provisional {
+		n--
+	}
+	return records[:n]
+}
+
+// seasonMap indexes the loaded seasons by start year.
+func (d *DashboardData) seasonMap() map[int][]DayRecord {
+	m := make(map[int][]DayRecord, len(d.Seasons))
+	for _, s := range d.Seasons {
+		m[s.Config.Year] = s.Records
+	}
+	return m
+}
+
+// ─── API v2 ─────────────────────────────────────────────────
+
+// DashboardV2 is the /api/data.v2 payload. Numeric series carry no
+// presentation details; colors and line styles live in Styles, keyed
+// by series ID, so any charting library can consume the data.
+type DashboardV2 struct {
+	Version     int                `json:"version"`
+	GeneratedAt string             `json:"generatedAt"`
+	AsOf        string             `json:"asOf,omitempty"`
+	CurrentYear int                `json:"currentYear"`
+	Units       string             `json:"units"`
+	Series      []SeriesV2         `json:"series"`
+	Styles      map[string]StyleV2 `json:"styles"`
+	KPI         KPIData            `json:"kpi"`
+	Axis        AxisV2             `json:"axis"`
+	Warnings    []string           `json:"warnings,omitempty"`
+	StaleReason string             `json:"staleReason,omitempty"`
+	// ScenarioNote explains why no projection series are present.
+	ScenarioNote string `json:"scenarioNote,omitempty"`
+}
+
+// SeriesV2 is one line: a season or a scenario projection. X is
+// days since winter start, Y the fill level in Units.
+type SeriesV2 struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"` // "season" or "scenario"
+	Name       string    `json:"name"`
+	Year       int       `json:"year,omitempty"`
+	IsCurrent  bool      `json:"isCurrent,omitempty"`
+	X          []float64 `json:"x"`
+	Y          []float64 `json:"y"`
+	Dates      []string  `json:"dates"`
+	Injection  []float64 `json:"injection,omitempty"`
+	Withdrawal []float64 `json:"withdrawal,omitempty"`
+	NetFlow    []float64 `json:"netFlow,omitempty"`
+	CumNetFlow []float64 `json:"cumNetFlow,omitempty"`
+	HitDate    string    `json:"hitDate,omitempty"`
+	DaysLeft   int       `json:"daysLeft,omitempty"`
+}
+
+type StyleV2 struct {
+	Color     string `json:"color"`
+	Width     int    `json:"width,omitempty"`
+	Dash      string `json:"dash"`
+	FillColor string `json:"fillColor,omitempty"`
+}
+
+type AxisV2 struct {
+	TickVals   []int    `json:"tickVals"`
+	TickLabels []string `json:"tickLabels"`
+}
+
+func toV2(d *DashboardData) DashboardV2 {
+	out := DashboardV2{
+		Version:      2,
+		GeneratedAt:  d.GeneratedAt,
+		CurrentYear:  d.CurrentYear,
+		Units:        d.Units,
+		Styles:       make(map[string]StyleV2),
+		KPI:          d.KPI,
+		Axis:         AxisV2{TickVals: d.TickVals, TickLabels: d.TickLabels},
+		Warnings:     d.Warnings,
+		StaleReason:  d.StaleReason,
+		ScenarioNote: d.ScenarioNote,
+		AsOf:         d.AsOf,
+	}
+	for _, s := range d.Seasons {
+		id := fmt.Sprintf("season-%d", s.Config.Year)
+		sr := SeriesV2{
+			ID: id, Kind: "season", Name: s.Config.Name,
+			Year: s.Config.Year, IsCurrent: s.Config.IsCurrent,
+		}
+		for _, r := range s.Records {
+			sr.X = append(sr.X, float64(r.DaysElapsed))
+			sr.Y = append(sr.Y, r.Full)
+			sr.Dates = append(sr.Dates, r.Date.Format("2006-01-02"))
+			sr.Injection = append(sr.Injection, r.Injection)
+			sr.Withdrawal = append(sr.Withdrawal, r.Withdrawal)
+			sr.NetFlow = append(sr.NetFlow, r.NetFlow)
+			sr.CumNetFlow = append(sr.CumNetFlow, r.CumNetFlow)
+		}
+		out.Series = append(out.Series, sr)
+		out.Styles[id] = StyleV2{
+			Color: s.Config.Color, Width: s.Config.Width,
+			Dash: s.Config.Dash, FillColor: s.Config.FillColor,
+		}
+	}
+	for _, sc := range d.Scenarios {
+		id := "scenario-" + strings.ToLower(sc.Name)
+		sr := SeriesV2{
+			ID: id, Kind: "scenario", Name: sc.Label,
+			HitDate: sc.HitDate, DaysLeft: sc.DaysLeft,
+		}
+		for _, p := range sc.Points {
+			sr.X = append(sr.X, p.X)
+			sr.Y = append(sr.Y, p.Y)
+			sr.Dates = append(sr.Dates, p.HoverDate)
+		}
+		out.Series = append(out.Series, sr)
+		out.Styles[id] = StyleV2{Color: sc.Color, Dash: sc.Dash}
+	}
+	return out
+}
+
+// ─── Schema ─────────────────────────────────────────────────
+
+// jsonSchema describes the JSON encoding of t as a JSON Schema
+// (draft 2020-12), derived from the Go types and their json tags so it
+// cannot drift from what the API actually sends. Named structs go into
+// defs and are referenced.
+func jsonSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return map[string]interface{}{
+			"anyOf": []interface{}{jsonSchema(t.Elem(), defs), map[string]interface{}{"type": "null"}},
+		}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	// nil slices and maps encode as null.
+	case reflect.Slice:
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": jsonSchema(t.Elem(), defs)}
+	case reflect.Array:
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": []string{"object", "null"}, "additionalProperties": jsonSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+		if _, ok := defs[t.Name()]; ok {
+			return ref
+		}
+		defs[t.Name()] = nil // placeholder for recursive types
+		props := map[string]interface{}{}
+		var required []string
+		structSchemaFields(t, defs, props, &required)
+		def := map[string]interface{}{"type": "object", "properties": props}
+		if len(required) > 0 {
+			sort.Strings(required)
+			def["required"] = required
+		}
+		defs[t.Name()] = def
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+// structSchemaFields adds the exported fields of t, flattening
+// embedded structs the way encoding/json does.
+func structSchemaFields(t reflect.Type, defs, props map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			structSchemaFields(f.Type, defs, props, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = jsonSchema(f.Type, defs)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// schemaDocument wraps the schema of the given payload type.
+func schemaDocument(v interface{}, title, description string) map[string]interface{} {
+	defs := map[string]interface{}{}
+	root := jsonSchema(reflect.TypeOf(v), defs)
+	doc := map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       title,
+		"description": description,
+		"$defs":       defs,
+	}
+	for k, v := range root {
+		doc[k] = v
+	}
+	return doc
 }
 
 // ─── Data Cache ─────────────────────────────────────────────
@@ -118,16 +1203,29 @@ type Cache struct {
 	mu          sync.RWMutex
 	data        *DashboardData
 	lastFetched time.Time
+	cleared     bool
 	ttl         time.Duration
-	building    sync.Mutex
+	builds      BuildGroup
+	ready       atomic.Bool
+	// hits and misses count getDashboard lookups; a miss is one that
+	// had to build.
+	hits, misses atomic.Int64
+	// notify, if set, is called with every newly installed build.
+	notify func(*DashboardData)
 }
 
-var cache = &Cache{ttl: 2 * time.Hour}
+// cache holds the country aggregate. main sets its TTL and share
+// window from the Config.
+var cache = &Cache{
+	ttl:    defaultCacheTTL,
+	builds: BuildGroup{shareWindow: defaultBuildShareWindow},
+	notify: streamHub.Publish,
+}
 
 func (c *Cache) Get() *DashboardData {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	if c.data != nil && time.Since(c.lastFetched) < c.ttl {
+	if c.data != nil && !c.cleared && time.Since(c.lastFetched) < c.ttl {
 		return c.data
 	}
 	return nil
@@ -135,626 +1233,4531 @@ func (c *Cache) Get() *DashboardData {
 
 func (c *Cache) Set(d *DashboardData) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 	c.data = d
 	c.lastFetched = time.Now()
+	c.cleared = false
+	c.ready.Store(true)
+	c.mu.Unlock()
+	if c.notify != nil {
+		c.notify(d)
+	}
 }
 
-func (c *Cache) Clear() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.data = nil
+// Ready reports whether the cache has ever held data.
+func (c *Cache) Ready() bool {
+	return c.ready.Load()
 }
 
-// ─── Season Year Logic ──────────────────────────────────────
+// Latest returns the last good build regardless of TTL. It survives
+// Clear, so a failed rebuild can fall back to it.
+func (c *Cache) Latest() *DashboardData {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.data
+}
 
-// currentWinterStartYear returns the start year of the
-// winter season that is currently active.
-// Winter 2025/26 starts Nov 2025, so from Nov 2025 through
-// ~Mar 2026 the "current winter start year" is 2025.
-func currentWinterStartYear() int {
-	now := time.Now()
-	year := now.Year()
-	month := now.Month()
+func (c *Cache) LastFetched() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastFetched
+}
 
-	// If we're in Jan–Oct, the winter started LAST year
-	// (e.g. Feb 2026 → winter started Nov 2025 → return 2025)
-	if month < 11 {
-		return year - 1
+// Remaining returns how long the cached data stays fresh, or 0 if it
+// is missing or expired.
+func (c *Cache) Remaining() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.data == nil || c.cleared {
+		return 0
 	}
-	// Nov or Dec → winter started this year
-	return year
+	return max(c.ttl-time.Since(c.lastFetched), 0)
 }
 
-// ─── API Fetching ───────────────────────────────────────────
-
-func fetchSeasonWithRetry(startYear int) ([]DayRecord, error) {
-	var lastErr error
-	for attempt := 1; attempt <= retryAttempts; attempt++ {
-		records, err := fetchSeason(startYear)
-		if err == nil {
-			return records, nil
-		}
-		lastErr = err
-		log.Printf("    ⚠️  Attempt %d/%d for %d failed: %v",
-			attempt, retryAttempts, startYear, err)
-		if attempt < retryAttempts {
-			wait := retryDelay * time.Duration(attempt)
-			log.Printf("    ⏳ Retrying in %v...", wait)
-			time.Sleep(wait)
-		}
+// HitRatio returns the share of lookups served from the cache, or 0
+// before the first lookup.
+func (c *Cache) HitRatio() (hits, misses int64, ratio float64) {
+	hits, misses = c.hits.Load(), c.misses.Load()
+	if total := hits + misses; total > 0 {
+		ratio = float64(hits) / float64(total)
 	}
-	return nil, fmt.Errorf("all %d attempts failed for %d: %w",
-		retryAttempts, startYear, lastErr)
+	return hits, misses, ratio
 }
 
-func fetchSeason(startYear int) ([]DayRecord, error) {
-	startDate := fmt.Sprintf("%d-%s", startYear, winterStartMD)
-	now := time.Now()
+// Clear expires the cached data so the next Get misses. The data
+// itself is kept for Latest.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cleared = true
+}
+
+// BuildGroup coalesces concurrent builds: while one runs, every other
+// caller waits for it and gets its result instead of building again.
+// A failed result is also handed to callers arriving within
+// shareWindow after it, so requests queued behind a failing cold start
+// don't each retry in turn.
+type BuildGroup struct {
+	shareWindow time.Duration
+
+	mu   sync.Mutex
+	call *buildCall
+}
+
+type buildCall struct {
+	done     chan struct{}
+	data     *DashboardData
+	err      error
+	finished time.Time
+}
+
+// Do runs build unless a build is in flight or failed moments ago, in
+// which case it returns that result with shared set.
+func (g *BuildGroup) Do(build func() (*DashboardData, error)) (data *DashboardData, err error, shared bool) {
+	g.mu.Lock()
+	if c := g.call; c != nil {
+		select {
+		case <-c.done:
+			if c.err != nil && time.Since(c.finished) < g.shareWindow {
+				g.mu.Unlock()
+				return c.data, c.err, true
+			}
+		default:
+			g.mu.Unlock()
+			<-c.done
+			return c.data, c.err, true
+		}
+	}
+	c := &buildCall{done: make(chan struct{})}
+	g.call = c
+	g.mu.Unlock()
+
+	defer func() {
+		c.finished = time.Now()
+		close(c.done)
+	}()
+	c.data, c.err = build()
+	return c.data, c.err, false
+}
+
+// Forget drops a remembered failure so the next Do builds again. A
+// build still in flight is unaffected.
+func (g *BuildGroup) Forget() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c := g.call; c != nil {
+		select {
+		case <-c.done:
+			g.call = nil
+		default:
+		}
+	}
+}
+
+// SeasonCache keeps completed seasons by start year so rebuilds
+// only need to refetch the current season.
+type SeasonCache struct {
+	mu      sync.RWMutex
+	records map[seasonKey][]DayRecord
+	cwsy    int
+}
+
+// seasonKey separates the country aggregate from facility drilldowns
+// of the same winter.
+type seasonKey struct {
+	fac  Facility
+	year int
+}
+
+var seasonCache = &SeasonCache{records: make(map[seasonKey][]DayRecord)}
+
+func (c *SeasonCache) Get(fac Facility, year int) ([]DayRecord, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r, ok := c.records[seasonKey{fac, year}]
+	return r, ok
+}
+
+func (c *SeasonCache) Set(fac Facility, year int, records []DayRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records[seasonKey{fac, year}] = records
+}
+
+// Seasons returns the cached seasons for fac by start year.
+func (c *SeasonCache) Seasons(fac Facility) map[int][]DayRecord {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make(map[int][]DayRecord)
+	for k, r := range c.records {
+		if k.fac == fac {
+			out[k.year] = r
+		}
+	}
+	return out
+}
+
+// resetIfRolledOver drops all cached seasons when the winter start
+// year changes, so nothing cached under the old season survives.
+func (c *SeasonCache) resetIfRolledOver(cwsy int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cwsy != cwsy {
+		if c.cwsy != 0 {
+			log.Printf("  🔄 Winter rolled over %d → %d, clearing season cache", c.cwsy, cwsy)
+		}
+		c.records = make(map[seasonKey][]DayRecord)
+		c.cwsy = cwsy
+	}
+}
+
+// UpstreamCache remembers the last successful AGSI response per
+// season so fetchSeason can send If-Modified-Since and reuse the
+// parsed records on 304 Not Modified.
+type UpstreamCache struct {
+	mu      sync.Mutex
+	entries map[seasonKey]upstreamEntry
+}
+
+type upstreamEntry struct {
+	lastModified string // Last-Modified from AGSI, or our fetch time
+	records      []DayRecord
+}
+
+// maxUpstreamEntries bounds the cache; it is simply reset when full.
+const maxUpstreamEntries = 64
+
+var upstreamCache = &UpstreamCache{entries: make(map[seasonKey]upstreamEntry)}
+
+func (c *UpstreamCache) Get(fac Facility, year int) (upstreamEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[seasonKey{fac, year}]
+	return e, ok
+}
+
+func (c *UpstreamCache) Set(fac Facility, year int, e upstreamEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxUpstreamEntries {
+		c.entries = make(map[seasonKey]upstreamEntry)
+	}
+	c.entries[seasonKey{fac, year}] = e
+}
+
+// ─── Live Stream ────────────────────────────────────────────
+
+// StreamHub fans newly built dashboards out to /api/stream clients.
+// Each subscriber has a one-slot buffer that always holds the latest
+// build, so a slow client skips builds instead of stalling Publish.
+type StreamHub struct {
+	mu     sync.Mutex
+	subs   map[chan *DashboardData]struct{}
+	closed bool
+}
+
+var streamHub = &StreamHub{subs: make(map[chan *DashboardData]struct{})}
+
+// Subscribe registers a client. It fails once the hub is closed or
+// maxStreamClients are connected.
+func (h *StreamHub) Subscribe() (chan *DashboardData, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed || len(h.subs) >= maxStreamClients {
+		return nil, false
+	}
+	ch := make(chan *DashboardData, 1)
+	h.subs[ch] = struct{}{}
+	return ch, true
+}
+
+func (h *StreamHub) Unsubscribe(ch chan *DashboardData) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, ch)
+}
+
+func (h *StreamHub) Publish(d *DashboardData) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- d
+	}
+}
+
+// Close disconnects every client and refuses new ones, so streams
+// don't hold up a graceful shutdown.
+func (h *StreamHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.subs {
+		close(ch)
+		delete(h.subs, ch)
+	}
+}
+
+func (h *StreamHub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// ─── Facilities ─────────────────────────────────────────────
+
+// Facility selects a single storage site instead of the country
+// aggregate. AGSI identifies sites by the facility EIC; the operator
+// (company) EIC is optional and only narrows the query further. The
+// zero value means the country aggregate.
+type Facility struct {
+	Company string
+	EIC     string
+}
+
+// eicPattern matches a 16 character Energy Identification Code.
+var eicPattern = regexp.MustCompile(`^[0-9A-Z-]{16}$`)
+
+func (f Facility) IsZero() bool { return f == Facility{} }
+
+// facilityFromQuery reads ?eic= and the optional ?company= from a
+// request. Both are validated so arbitrary input never reaches the
+// AGSI URL or the fixture path.
+func facilityFromQuery(r *http.Request) (Facility, error) {
+	q := r.URL.Query()
+	fac := Facility{
+		Company: strings.ToUpper(strings.TrimSpace(q.Get("company"))),
+		EIC:     strings.ToUpper(strings.TrimSpace(q.Get("eic"))),
+	}
+	if fac.EIC == "" {
+		if fac.Company != "" {
+			return Facility{}, fmt.Errorf("company requires eic")
+		}
+		return Facility{}, nil
+	}
+	if !eicPattern.MatchString(fac.EIC) {
+		return Facility{}, fmt.Errorf("eic must be a 16 character EIC code")
+	}
+	if fac.Company != "" && !eicPattern.MatchString(fac.Company) {
+		return Facility{}, fmt.Errorf("company must be a 16 character EIC code")
+	}
+	return fac, nil
+}
+
+// FacilityCaches holds a dashboard cache per drilled-down facility;
+// the country aggregate keeps using cache.
+type FacilityCaches struct {
+	mu     sync.Mutex
+	caches map[Facility]*Cache
+}
+
+// maxFacilityCaches bounds how many facilities are kept at once.
+const maxFacilityCaches = 16
+
+var facilityCaches = &FacilityCaches{caches: make(map[Facility]*Cache)}
+
+func (f *FacilityCaches) get(fac Facility) *Cache {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c, ok := f.caches[fac]; ok {
+		return c
+	}
+	if len(f.caches) >= maxFacilityCaches {
+		f.caches = make(map[Facility]*Cache)
+	}
+	c := &Cache{ttl: cache.ttl, builds: BuildGroup{shareWindow: cache.builds.shareWindow}}
+	f.caches[fac] = c
+	return c
+}
+
+// ─── Build Status ───────────────────────────────────────────
+
+// SeasonStatus is the outcome of loading one season in the last build.
+type SeasonStatus struct {
+	Name    string    `json:"name"`
+	OK      bool      `json:"ok"`
+	Records int       `json:"records"`
+	Error   string    `json:"error,omitempty"`
+	Fetch   FetchInfo `json:"fetch"`
+}
+
+// FetchInfo describes how a season's records were loaded.
+type FetchInfo struct {
+	Source     string `json:"source"` // "api", "batch", "fixture" or "cache"
+	DurationMs int64  `json:"durationMs"`
+	// BatchDurationMs is the time taken by the whole batched query a
+	// "batch" season was split from, shared with the other seasons in
+	// it. Their DurationMs stays 0.
+	BatchDurationMs int64 `json:"batchDurationMs,omitempty"`
+	HTTPStatus      int   `json:"httpStatus,omitempty"`
+	Attempts        int   `json:"attempts,omitempty"`
+	RawRecords      int   `json:"rawRecords"`
+	Dropped         int   `json:"dropped"`  // records with unparseable dates
+	Clamped         int   `json:"clamped"`  // fill slightly outside [0,100]
+	Rejected        int   `json:"rejected"` // implausible fill, dropped
+}
+
+// BuildStatus tracks the outcome of the most recent builds for
+// diagnostics in /api/health.
+type BuildStatus struct {
+	backoffBase, backoffMax time.Duration
+
+	mu          sync.RWMutex
+	lastError   string
+	lastErrorAt time.Time
+	lastSuccess time.Time
+	seasons     map[int]SeasonStatus
+
+	// Consecutive build failures and the earliest time the next
+	// automatic build may run.
+	failures    int
+	nextAttempt time.Time
+}
+
+// buildStatus records the aggregate's builds. main replaces it with
+// one using the backoff from the Config.
+var buildStatus = newBuildStatus(defaultBackoffBase, defaultBackoffMax)
+
+func newBuildStatus(backoffBase, backoffMax time.Duration) *BuildStatus {
+	return &BuildStatus{backoffBase: backoffBase, backoffMax: backoffMax, seasons: make(map[int]SeasonStatus)}
+}
+
+func (b *BuildStatus) resetSeasons() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seasons = make(map[int]SeasonStatus)
+}
+
+func (b *BuildStatus) recordSeason(cfg SeasonConfig, records int, info FetchInfo, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := SeasonStatus{Name: cfg.Name, OK: err == nil && records > 0, Records: records, Fetch: info}
+	if err != nil {
+		st.Error = err.Error()
+	} else if records == 0 {
+		st.Error = "no data"
+	}
+	b.seasons[cfg.Year] = st
+}
+
+func (b *BuildStatus) recordBuild(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.lastError = err.Error()
+		b.lastErrorAt = time.Now()
+		b.failures++
+		wait := buildBackoff(b.failures, b.backoffBase, b.backoffMax)
+		b.nextAttempt = b.lastErrorAt.Add(wait)
+		log.Printf("  ⏳ Build failed %d time(s) in a row, next automatic attempt in %v",
+			b.failures, wait)
+		return
+	}
+	b.lastSuccess = time.Now()
+	b.failures = 0
+	b.nextAttempt = time.Time{}
+}
+
+// buildBackoff doubles base for every consecutive failure, capped at
+// limit.
+func buildBackoff(failures int, base, limit time.Duration) time.Duration {
+	wait := base
+	for i := 1; i < failures && wait < limit; i++ {
+		wait *= 2
+	}
+	return min(wait, limit)
+}
+
+// backoffRemaining reports how long automatic builds must still wait.
+func (b *BuildStatus) backoffRemaining() time.Duration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return time.Until(b.nextAttempt)
+}
+
+// report adds the build diagnostics to a health response.
+func (b *BuildStatus) report(resp map[string]interface{}) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.lastError != "" {
+		resp["lastError"] = b.lastError
+		resp["lastErrorAt"] = b.lastErrorAt.Format(time.RFC3339)
+	}
+	if !b.lastSuccess.IsZero() {
+		resp["lastSuccess"] = b.lastSuccess.Format(time.RFC3339)
+	}
+	backoff := map[string]interface{}{"consecutiveFailures": b.failures}
+	if wait := time.Until(b.nextAttempt); wait > 0 {
+		backoff["nextAttempt"] = b.nextAttempt.Format(time.RFC3339)
+		backoff["remainingSeconds"] = int(math.Ceil(wait.Seconds()))
+	}
+	resp["backoff"] = backoff
+	seasons := make(map[int]SeasonStatus, len(b.seasons))
+	for y, st := range b.seasons {
+		seasons[y] = st
+	}
+	resp["seasons"] = seasons
+}
+
+// ─── Snapshot History ───────────────────────────────────────
+
+// Snapshot is one observation of the KPIs at build time. This is our
+// own timeline, independent of the daily AGSI granularity.
+type Snapshot struct {
+	Timestamp   string  `json:"timestamp"`
+	CurrentFill float64 `json:"currentFill"`
+	DaysToCrit  int     `json:"daysToCrit"`
+}
+
+// History is a bounded ring buffer of snapshots.
+type History struct {
+	mu    sync.Mutex
+	buf   []Snapshot
+	next  int
+	count int
+}
+
+// history keeps the KPI snapshots served by /api/history. main
+// replaces it with one sized from the Config.
+var history = newHistory(defaultHistorySize)
+
+func newHistory(size int) *History {
+	if size < 1 {
+		size = defaultHistorySize
+	}
+	return &History{buf: make([]Snapshot, size)}
+}
+
+func (h *History) Add(s Snapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf[h.next] = s
+	h.next = (h.next + 1) % len(h.buf)
+	if h.count < len(h.buf) {
+		h.count++
+	}
+}
+
+// All returns the snapshots oldest first.
+func (h *History) All() []Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]Snapshot, 0, h.count)
+	start := (h.next - h.count + len(h.buf)) % len(h.buf)
+	for i := 0; i < h.count; i++ {
+		out = append(out, h.buf[(start+i)%len(h.buf)])
+	}
+	return out
+}
+
+// ─── Season Year Logic ──────────────────────────────────────
+
+// Calendar places the dashboard in time and says which seasons it
+// shows. It is resolved once by loadConfig and handed to everything
+// that picks the current season, a season's dates or its name.
+type Calendar struct {
+	// AsOf pins the date with AS_OF=YYYY-MM-DD, which renders the
+	// dashboard as it would have looked on that day: season selection,
+	// fetch end dates and data age all use it instead of the clock, and
+	// records after it are dropped. Zero follows the clock.
+	AsOf time.Time
+	// Summer (SEASON_MODE=summer) tracks the injection season from
+	// SummerStart to SummerEnd, both MM-DD within one calendar year,
+	// instead of the winter.
+	Summer                 bool
+	SummerStart, SummerEnd string
+	// TargetEnd is the MM-DD a winter runs to.
+	TargetEnd string
+	// YearMin and YearMax bound the season start years that may be
+	// fetched; YearMax 0 stands for the current season.
+	YearMin, YearMax int
+	// DetectStart (WINTER_START=detect) aligns winters on the first
+	// day from which net flow stays negative for PivotRunDays days,
+	// instead of on winterStartMD.
+	DetectStart  bool
+	PivotRunDays int
+}
+
+// Pinned reports whether AS_OF pins the date.
+func (c Calendar) Pinned() bool { return !c.AsOf.IsZero() }
+
+// Now returns the AS_OF date if pinned, the clock otherwise.
+func (c Calendar) Now() time.Time {
+	if c.Pinned() {
+		return c.AsOf
+	}
+	return time.Now().In(displayLoc)
+}
+
+// TrimAsOf drops the records of gas days after the AS_OF date.
+func (c Calendar) TrimAsOf(records []DayRecord) []DayRecord {
+	if !c.Pinned() {
+		return records
+	}
+	end := c.AsOf.AddDate(0, 0, 1)
+	n := sort.Search(len(records), func(i int) bool {
+		return !records[i].Date.Before(end)
+	})
+	return records[:n]
+}
+
+// CurrentStartYear returns the start year of the winter season that
+// is currently active, or in summer mode the year of the current
+// injection season.
+func (c Calendar) CurrentStartYear() int {
+	if c.Summer {
+		return summerStartYearAt(c.Now(), c.SummerStart)
+	}
+	return winterStartYearAt(c.Now())
+}
+
+// winterStartYearAt returns the start year of the winter season
+// active at t. Winter 2025/26 starts Nov 2025, so from Nov 2025
+// through Oct 2026 the "current winter start year" is 2025.
+func winterStartYearAt(t time.Time) int {
+	year := t.Year()
+	month := t.Month()
+
+	// If we're in Jan–Oct, the winter started LAST year
+	// (e.g. Feb 2026 → winter started Nov 2025 → return 2025)
+	if month < 11 {
+		return year - 1
+	}
+	// Nov or Dec → winter started this year
+	return year
+}
+
+// summerStartYearAt returns the year of the injection season opening
+// on the MM-DD start that is active at t. Before the season opens the
+// previous one stays current, so Jan 2026 still shows summer 2025.
+func summerStartYearAt(t time.Time, start string) int {
+	if t.Format("01-02") < start {
+		return t.Year() - 1
+	}
+	return t.Year()
+}
+
+// ─── Season Mode ────────────────────────────────────────────
+
+// StartDate returns the first day of the season starting in startYear
+// as YYYY-MM-DD.
+func (c Calendar) StartDate(startYear int) string {
+	if c.Summer {
+		return fmt.Sprintf("%d-%s", startYear, c.SummerStart)
+	}
+	return fmt.Sprintf("%d-%s", startYear, winterStartMD)
+}
+
+// EndDate returns the target end date of the season starting in
+// startYear as YYYY-MM-DD.
+func (c Calendar) EndDate(startYear int) string {
+	if c.Summer {
+		return fmt.Sprintf("%d-%s", startYear, c.SummerEnd)
+	}
+	return fmt.Sprintf("%d-%s", startYear+1, c.TargetEnd)
+}
+
+// Days returns the length of the season starting in startYear, from
+// StartDate to EndDate inclusive.
+func (c Calendar) Days(startYear int) int {
+	start, _ := time.ParseInLocation("2006-01-02", c.StartDate(startYear), displayLoc)
+	end, _ := time.ParseInLocation("2006-01-02", c.EndDate(startYear), displayLoc)
+	return int(math.Round(end.Sub(start).Hours()/24)) + 1
+}
+
+// Label returns the short label of a season: "2025/26" for a winter,
+// "2026" for an injection season.
+func (c Calendar) Label(year int) string {
+	if c.Summer {
+		return strconv.Itoa(year)
+	}
+	return fmt.Sprintf("%d/%02d", year, (year+1)%100)
+}
+
+// Name returns the display name of a season, e.g. "Winter 2025/26".
+func (c Calendar) Name(year int) string {
+	if c.Summer {
+		return "Summer " + c.Label(year)
+	}
+	return "Winter " + c.Label(year)
+}
+
+// ─── API Fetching ───────────────────────────────────────────
+
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 " +
+	"(KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+// apiClient is shared by all AGSI requests. Its transport honours
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+var apiClient = &http.Client{
+	Timeout:   fetchTimeout,
+	Transport: newAPITransport(),
+}
+
+func newAPITransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	return t
+}
+
+// YearRange returns the season start years that may be fetched:
+// YearMin (default: start of AGSI coverage) through YearMax, which can
+// narrow but never exceed the current season.
+func (c Calendar) YearRange() (lo, hi int) {
+	hi = c.CurrentStartYear()
+	if c.YearMax != 0 {
+		hi = min(c.YearMax, hi)
+	}
+	return c.YearMin, hi
+}
+
+// ValidateYear rejects years outside YearRange before any request is
+// built.
+func (c Calendar) ValidateYear(startYear int) error {
+	lo, hi := c.YearRange()
+	if startYear < lo || startYear > hi {
+		return fmt.Errorf("%w: %d is outside %d–%d", ErrSeasonRange, startYear, lo, hi)
+	}
+	return nil
+}
+
+// sleepCtx waits for d, returning early with ctx's error once it is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LatencyTracker keeps a moving average of AGSI response times to pace
+// consecutive calls: the delay between them follows the average,
+// within min and max. Until a response has been timed it is
+// delayBetweenCalls.
+type LatencyTracker struct {
+	min, max time.Duration
+
+	mu  sync.Mutex
+	avg time.Duration
+}
+
+// apiLatency paces the AGSI calls. main replaces it with one bounded
+// by FETCH_DELAY_MIN and FETCH_DELAY_MAX from the Config.
+var apiLatency = newLatencyTracker(defaultFetchDelayMin, defaultFetchDelayMax)
+
+func newLatencyTracker(min, max time.Duration) *LatencyTracker {
+	return &LatencyTracker{min: min, max: max}
+}
+
+// Record adds a response time to the exponentially weighted average.
+func (l *LatencyTracker) Record(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.avg == 0 {
+		l.avg = d
+		return
+	}
+	l.avg = time.Duration(latencyAlpha*float64(d) + (1-latencyAlpha)*float64(l.avg))
+}
+
+func (l *LatencyTracker) Average() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.avg
+}
+
+// Delay is the pause before the next call.
+func (l *LatencyTracker) Delay() time.Duration {
+	avg := l.Average()
+	if avg == 0 {
+		return delayBetweenCalls
+	}
+	return min(max(avg, l.min), l.max)
+}
+
+// retryJitter is the random source for the retry backoff, a value in
+// [0, 1). Replace it for deterministic retries.
+var retryJitter = rand.Float64
+
+// retrySleep waits between retry attempts. Replace it to retry
+// without waiting.
+var retrySleep = sleepCtx
+
+// backoffDelay is the wait before retry attempt+1: retryDelay*attempt
+// scaled by ±50% according to jitter, so instances failing together
+// don't retry in lockstep.
+func backoffDelay(attempt int, jitter float64) time.Duration {
+	base := retryDelay * time.Duration(attempt)
+	return time.Duration(float64(base) * (0.5 + jitter))
+}
+
+// ─── Circuit Breaker ────────────────────────────────────────
+
+// Breaker states, as reported in /api/health.
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// CircuitBreaker stops calling AGSI during a sustained outage. After
+// threshold consecutive failed calls (BREAKER_THRESHOLD, default 5,
+// 0 disables) it opens and every call fails fast with ErrCircuitOpen,
+// so callers serve stale data instead of running the full retry
+// sequence. Once cooldown (BREAKER_COOLDOWN, default 5m) has passed, a
+// single trial call goes through: success closes the breaker, failure
+// opens it again.
+//
+// Only errors that retryable accepts count as failures; a 4xx or an
+// empty season means AGSI is answering.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trips    int
+}
+
+// agsiBreaker guards the AGSI source. main replaces it with one built
+// from the Config.
+var agsiBreaker = newCircuitBreaker(defaultBreakerThreshold, defaultBreakerCooldown)
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown, state: breakerClosed}
+}
+
+// Allow reports whether a call may go out, or ErrCircuitOpen.
+func (b *CircuitBreaker) Allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if wait := time.Until(b.openedAt.Add(b.cooldown)); wait > 0 {
+			return fmt.Errorf("%w, next trial in %v", ErrCircuitOpen,
+				time.Duration(math.Ceil(wait.Seconds()))*time.Second)
+		}
+		log.Println("  🔌 Circuit breaker half-open, sending a trial request")
+		b.state = breakerHalfOpen
+		return nil
+	case breakerHalfOpen:
+		return fmt.Errorf("%w, trial request in flight", ErrCircuitOpen)
+	}
+	return nil
+}
+
+// Record updates the breaker with the outcome of an allowed call.
+func (b *CircuitBreaker) Record(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// Says nothing about AGSI; a cancelled trial is retried next call.
+		if b.state == breakerHalfOpen {
+			b.state = breakerOpen
+		}
+		return
+	}
+	if err == nil || !retryable(err) {
+		if b.state != breakerClosed {
+			log.Println("  🔌 Circuit breaker closed")
+		}
+		b.state, b.failures = breakerClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		if b.state != breakerOpen {
+			b.trips++
+		}
+		b.state, b.openedAt = breakerOpen, time.Now()
+		log.Printf("  🔌 Circuit breaker open after %d consecutive failure(s), pausing AGSI calls for %v",
+			b.failures, b.cooldown)
+	}
+}
+
+// report adds the breaker state to a health response.
+func (b *CircuitBreaker) report(resp map[string]interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	breaker := map[string]interface{}{
+		"state":               b.state,
+		"consecutiveFailures": b.failures,
+		"trips":               b.trips,
+	}
+	if b.state == breakerOpen {
+		until := b.openedAt.Add(b.cooldown)
+		breaker["openedAt"] = b.openedAt.Format(time.RFC3339)
+		breaker["retryAt"] = until.Format(time.RFC3339)
+	}
+	resp["circuitBreaker"] = breaker
+}
+
+func fetchSeasonWithRetry(ctx context.Context, cal Calendar, startYear int, fac Facility) ([]DayRecord, FetchInfo, error) {
+	if err := cal.ValidateYear(startYear); err != nil {
+		return nil, FetchInfo{}, err
+	}
+	var lastErr error
+	var info FetchInfo
+	for attempt := 1; attempt <= retryAttempts; attempt++ {
+		records, attemptInfo, err := fetchSeason(ctx, cal, startYear, fac)
+		// Report the last attempt, with the time spent on all of them.
+		attemptInfo.DurationMs += info.DurationMs
+		attemptInfo.Attempts = attempt
+		info = attemptInfo
+		if err == nil {
+			return records, info, nil
+		}
+		if !retryable(err) {
+			return nil, info, err
+		}
+		lastErr = err
+		log.Printf("    ⚠️  Attempt %d/%d for %d failed: %v",
+			attempt, retryAttempts, startYear, err)
+		if attempt < retryAttempts {
+			wait := backoffDelay(attempt, retryJitter())
+			log.Printf("    ⏳ Retrying in %v...", wait.Round(time.Millisecond))
+			if err := retrySleep(ctx, wait); err != nil {
+				return nil, info, err
+			}
+		}
+	}
+	return nil, info, fmt.Errorf("all %d attempts failed for %d: %w",
+		retryAttempts, startYear, lastErr)
+}
+
+// fetchSeason loads one season from the configured data source.
+func fetchSeason(ctx context.Context, cal Calendar, startYear int, fac Facility) ([]DayRecord, FetchInfo, error) {
+	if err := cal.ValidateYear(startYear); err != nil {
+		return nil, FetchInfo{}, err
+	}
+	return activeSource.FetchSeason(ctx, startYear, fac)
+}
+
+// ─── Data Sources ───────────────────────────────────────────
+
+// DataSource provides the day records of one winter, for the country
+// aggregate or a facility. Records come back sorted with trend and
+// averages filled in, ready for the dashboard.
+type DataSource interface {
+	Name() string
+	FetchSeason(ctx context.Context, startYear int, fac Facility) ([]DayRecord, FetchInfo, error)
+}
+
+// batchSource is implemented by sources that can load several winters
+// in one request (see BATCH_FETCH).
+type batchSource interface {
+	FetchSeasons(ctx context.Context, years []int, fac Facility) (map[int][]DayRecord, map[int]FetchInfo, error)
+}
+
+// dataSources lists the providers selectable with DATA_SOURCE.
+var dataSources = map[string]func(Config) DataSource{
+	"agsi": func(c Config) DataSource { return newAGSISource(c) },
+}
+
+// activeSource is the provider every fetch goes through, set from the
+// startup Config.
+var activeSource DataSource = newAGSISource(defaultConfig())
+
+// newDataSource returns the provider to fetch from: saved responses
+// when AGSI_SOURCE=file://..., otherwise DATA_SOURCE (default agsi).
+// c must have passed validate.
+func newDataSource(c Config) DataSource {
+	if dir, ok := c.fixtureDir(); ok {
+		return fixtureSource{dir, c.Calendar, c.Records}
+	}
+	if newSource, ok := dataSources[c.DataSource]; ok {
+		return newSource(c)
+	}
+	return newAGSISource(c)
+}
+
+// fixtureSource reads saved AGSI responses from a directory.
+type fixtureSource struct {
+	dir  string
+	cal  Calendar
+	opts RecordOptions
+}
+
+func (f fixtureSource) Name() string { return "fixtures " + f.dir }
+
+func (f fixtureSource) FetchSeason(_ context.Context, startYear int, fac Facility) ([]DayRecord, FetchInfo, error) {
+	return loadSeasonFixture(f.cal, f.opts, f.dir, startYear, fac)
+}
+
+// agsiSource is the GIE AGSI+ transparency API.
+type agsiSource struct {
+	baseURL   string
+	apiKey    string
+	userAgent string
+	country   string
+	maxBody   int
+	cal       Calendar
+	opts      RecordOptions
+}
+
+func newAGSISource(c Config) agsiSource {
+	return agsiSource{baseURL: c.apiBaseURL(), apiKey: c.APIKey, userAgent: c.UserAgent,
+		country: c.Country, maxBody: c.MaxResponseBytes, cal: c.Calendar, opts: c.Records}
+}
+
+func (agsiSource) Name() string { return "agsi" }
+
+func (a agsiSource) FetchSeasons(ctx context.Context, years []int, fac Facility) (map[int][]DayRecord, map[int]FetchInfo, error) {
+	if err := agsiBreaker.Allow(); err != nil {
+		return nil, nil, err
+	}
+	records, infos, err := fetchSeasonsBatched(ctx, a, years, fac)
+	agsiBreaker.Record(err)
+	return records, infos, err
+}
+
+func (a agsiSource) FetchSeason(ctx context.Context, startYear int, fac Facility) ([]DayRecord, FetchInfo, error) {
+	if err := agsiBreaker.Allow(); err != nil {
+		return nil, FetchInfo{Source: "api"}, err
+	}
+	records, info, err := a.fetchSeason(ctx, startYear, fac)
+	agsiBreaker.Record(err)
+	return records, info, err
+}
+
+func (a agsiSource) fetchSeason(ctx context.Context, startYear int, fac Facility) ([]DayRecord, FetchInfo, error) {
+	startDate := a.cal.StartDate(startYear)
+	now := a.cal.Now()
+
+	cwsy := a.cal.CurrentStartYear()
+
+	var endDate string
+	if startYear == cwsy {
+		// Current season → end at today
+		endDate = now.Format("2006-01-02")
+	} else {
+		// Past season → end at March 31 of the following year
+		endDate = a.cal.EndDate(startYear)
+	}
+
+	// Sanity: don't fetch if start is in the future
+	seasonStartParsed, _ := time.ParseInLocation("2006-01-02", startDate, displayLoc)
+	if seasonStartParsed.After(now) {
+		return nil, FetchInfo{}, fmt.Errorf("%w: season %d starts in the future (%s)", ErrSeasonRange, startYear, startDate)
+	}
+
+	fromDate := startDate
+	if days := a.opts.seedDays(); days > 0 && startYear == cwsy {
+		fromDate = seasonStartParsed.AddDate(0, 0, -days).Format("2006-01-02")
+	}
+
+	log.Printf("  📡 Fetching %s: %s → %s",
+		a.cal.Label(startYear), startDate, endDate)
+
+	req, err := a.newRequest(ctx, a.queryURL(fromDate, endDate, fac))
+	if err != nil {
+		return nil, FetchInfo{}, err
+	}
+	prev, conditional := upstreamCache.Get(fac, startYear)
+	if conditional {
+		req.Header.Set("If-Modified-Since", prev.lastModified)
+	}
+	fetchedAt := time.Now()
+
+	resp, err := apiClient.Do(req)
+	// Failed calls count too: timeouts should slow us down the most.
+	apiLatency.Record(time.Since(fetchedAt))
+	info := FetchInfo{Source: "api", DurationMs: time.Since(fetchedAt).Milliseconds()}
+	if err != nil {
+		return nil, info, fmt.Errorf("HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+	info.HTTPStatus = resp.StatusCode
+
+	body, err := readAPIBody(resp, a.maxBody)
+	info.DurationMs = time.Since(fetchedAt).Milliseconds()
+	if err != nil {
+		return nil, info, err
+	}
+
+	log.Printf("     HTTP %d, %d bytes", resp.StatusCode, len(body))
+
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		log.Printf("     ♻️  %d not modified, reusing %d records", startYear, len(prev.records))
+		info.RawRecords = len(prev.records)
+		// A copy: the build flags anomalies in place while the cached
+		// dashboard still serves the previous one.
+		return slices.Clone(prev.records), info, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		preview := string(body)
+		if len(preview) > 500 {
+			preview = preview[:500]
+		}
+		return nil, info, &APIStatusError{Code: resp.StatusCode, Body: preview}
+	}
+
+	if err := checkJSONBody(resp, body); err != nil {
+		return nil, info, err
+	}
+	records, parsed, err := parseSeason(a.cal, a.opts, startYear, body, fac)
+	info.RawRecords, info.Dropped = parsed.RawRecords, parsed.Dropped
+	info.Clamped, info.Rejected = parsed.Clamped, parsed.Rejected
+	if err == nil && len(records) > 0 {
+		lastModified := resp.Header.Get("Last-Modified")
+		if lastModified == "" {
+			lastModified = fetchedAt.UTC().Format(http.TimeFormat)
+		}
+		upstreamCache.Set(fac, startYear, upstreamEntry{lastModified, slices.Clone(records)})
+	}
+	return records, info, err
+}
+
+// queryURL builds the AGSI query for a date range of the country
+// aggregate or a facility.
+func (a agsiSource) queryURL(from, to string, fac Facility) string {
+	url := fmt.Sprintf("%s?country=%s&from=%s&to=%s&size=%d",
+		a.baseURL, a.country, from, to, fetchSize)
+	if fac.Company != "" {
+		url += "&company=" + fac.Company
+	}
+	if fac.EIC != "" {
+		url += "&facility=" + fac.EIC
+	}
+	return url
+}
+
+// newRequest creates a GET request with the headers AGSI expects.
+func (a agsiSource) newRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("request creation: %w", err)
+	}
+
+	req.Header.Set("User-Agent", a.userAgent)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	req.Header.Set("Referer", "https://agsi.gie.eu/")
+	req.Header.Set("Origin", "https://agsi.gie.eu")
+
+	if a.apiKey != "" {
+		req.Header.Set("x-key", a.apiKey)
+	}
+	return req, nil
+}
+
+// loadSeasonFixture reads a saved AGSI response from <dir>/<year>.json,
+// or <dir>/<eic>/<year>.json for a facility, and runs it through the
+// same pipeline as a live fetch.
+func loadSeasonFixture(cal Calendar, opts RecordOptions, dir string, startYear int, fac Facility) ([]DayRecord, FetchInfo, error) {
+	if !fac.IsZero() {
+		dir = filepath.Join(dir, fac.EIC)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d.json", startYear))
+	log.Printf("  📂 Loading %s from %s", cal.Label(startYear), path)
+
+	start := time.Now()
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, FetchInfo{Source: "fixture"}, fmt.Errorf("reading fixture: %w", err)
+	}
+	records, info, err := parseSeason(cal, opts, startYear, body, fac)
+	info.Source = "fixture"
+	info.DurationMs = time.Since(start).Milliseconds()
+	return records, info, err
+}
+
+// parseSeason decodes an AGSI response body into sorted day records
+// with trend and 7d MA filled in. For a facility each record carries
+// the site name reported by AGSI.
+func parseSeason(cal Calendar, opts RecordOptions, startYear int, body []byte, fac Facility) ([]DayRecord, FetchInfo, error) {
+	apiResp, err := decodeAPIResponse(body)
+	if err != nil {
+		return nil, FetchInfo{}, err
+	}
+	// A single season fits one page of fetchSize; say so if it didn't.
+	if apiResp.LastPage > 1 {
+		log.Printf("     ⚠️  %s spans %d pages, only the first %d records are used",
+			cal.Label(startYear), apiResp.LastPage, len(apiResp.Data))
+	}
+	return seasonRecords(cal, opts, startYear, apiResp.Data, fac)
+}
+
+// readAPIBody reads an AGSI response body of at most limit bytes, so a
+// runaway upstream can't exhaust memory.
+func readAPIBody(resp *http.Response, limit int) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	if len(body) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, limit)
+	}
+	return body, nil
+}
+
+// checkJSONBody rejects a successful response that is really an HTML
+// page, going by its Content-Type or a leading '<'.
+func checkJSONBody(resp *http.Response, body []byte) error {
+	ct := resp.Header.Get("Content-Type")
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	if strings.HasPrefix(ct, "text/html") || (len(trimmed) > 0 && trimmed[0] == '<') {
+		return fmt.Errorf("%w (Content-Type %q, %d bytes)", ErrMaintenance, ct, len(body))
+	}
+	return nil
+}
+
+// decodeAPIResponse unmarshals an AGSI response body. A body that ends
+// before the JSON document does yields ErrTruncated; any other decode
+// failure is a ParseError.
+func decodeAPIResponse(body []byte) (APIResponse, error) {
+	var apiResp APIResponse
+	err := json.Unmarshal(body, &apiResp)
+	var syntax *json.SyntaxError
+	switch {
+	case err == nil:
+		return apiResp, nil
+	case errors.As(err, &syntax) && syntax.Offset >= int64(len(body)):
+		return apiResp, fmt.Errorf("%w after %d bytes: %v", ErrTruncated, len(body), err)
+	}
+	return apiResp, &ParseError{fmt.Errorf("JSON decode: %w", err)}
+}
+
+// RecordOptions tune how seasonRecords turns raw AGSI records into day
+// records.
+type RecordOptions struct {
+	MaxGap        int     // MAX_INTERPOLATE_GAP, missing days interpolated
+	FillTolerance float64 // FILL_TOLERANCE, see checkFill
+	SeedTrend     bool    // SEED_TREND=1, see seedDays
+	BusinessDays  bool    // TREND_DAYS=business, see businessTrends
+	EWMAAlpha     float64 // EWMA_ALPHA, in (0, 1]
+}
+
+// seasonRecords turns the raw AGSI records of one season into sorted
+// day records with trend, 7d MA and EWMA filled in.
+func seasonRecords(cal Calendar, opts RecordOptions, startYear int, data []APIRecord, fac Facility) ([]DayRecord, FetchInfo, error) {
+	startDate := cal.StartDate(startYear)
+	info := FetchInfo{RawRecords: len(data)}
+
+	if len(data) == 0 {
+		log.Printf("     ⚠️  Empty data array for %d", startYear)
+		return nil, info, ErrEmptyData
+	}
+
+	log.Printf("  ✅ %d: %d raw records", startYear, len(data))
+
+	// Parse records
+	seasonStart, _ := time.ParseInLocation("2006-01-02", startDate, displayLoc)
+	records := make([]DayRecord, 0, len(data))
+	tol := opts.FillTolerance
+
+	for _, r := range data {
+		date := parseDate(r.GasDayStart)
+		if date.IsZero() {
+			log.Printf("     ⚠️  Skipping unparseable date: %q", r.GasDayStart)
+			info.Dropped++
+			continue
+		}
+
+		// Round rather than truncate: days across a DST switch are 23h/25h.
+		elapsed := int(math.Round(date.Sub(seasonStart).Hours() / 24))
+
+		raw := parseFloat(r.Full)
+		full, ok := checkFill(raw, tol)
+		if !ok {
+			log.Printf("     ⚠️  Rejecting implausible fill %.2f%% on %s", raw, r.GasDayStart)
+			info.Rejected++
+			continue
+		}
+		if full != raw {
+			log.Printf("     ⚠️  Clamping fill %.2f%% on %s to %.0f%%", raw, r.GasDayStart, full)
+			info.Clamped++
+		}
+
+		var facility string
+		if !fac.IsZero() {
+			facility = r.Name
+		}
+
+		records = append(records, DayRecord{
+			Date:             date,
+			DateStr:          date.Format("02 Jan 2006"),
+			Full:             full,
+			Injection:        parseFloat(r.Injection),
+			Withdrawal:       parseFloat(r.Withdrawal),
+			GasInStorage:     parseFloat(r.GasInStorage),
+			WorkingGasVolume: parseFloat(r.WorkingGasVolume),
+			DaysElapsed:      elapsed,
+			Facility:         facility,
+		})
+	}
+
+	if len(records) == 0 {
+		return nil, info, &ParseError{errors.New("no valid records parsed")}
+	}
+
+	// Sort ascending; stable so revisions of the same day keep their
+	// response order for dedupeGasDays.
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Date.Before(records[j].Date)
+	})
+
+	records = dedupeGasDays(records)
+
+	records = interpolateGaps(records, opts.MaxGap)
+
+	// Calculate trend + 7d MA + EWMA, day over day or, with
+	// TREND_DAYS=business, weekday over weekday.
+	if opts.BusinessDays {
+		businessTrends(records, opts.EWMAAlpha)
+	} else {
+		calendarTrends(records, opts.EWMAAlpha)
+	}
+
+	// Seed records from before winter start (see seedDays) only feed
+	// the calculations above. Drop them and flag the season days whose
+	// trend or 7d MA still reaches into them: Trend[k] is taken against
+	// the last seed record, and the MA7 of days k..k+6 averages it.
+	if k := sort.Search(len(records), func(i int) bool {
+		return records[i].DaysElapsed >= 0
+	}); k > 0 {
+		for i := k; i < len(records) && i < k+7; i++ {
+			records[i].Seeded = true
+		}
+		log.Printf("     🌱 %d seed records before winter start", k)
+		records = records[k:]
+		if len(records) == 0 {
+			return nil, info, ErrEmptyData
+		}
+	}
+
+	// Net flow and its running total from winter start.
+	cum := 0.0
+	for i := range records {
+		records[i].NetFlow = records[i].Injection - records[i].Withdrawal
+		cum += records[i].NetFlow
+		records[i].CumNetFlow = cum
+	}
+
+	// Debug: print first and last record
+	log.Printf("     Range: %s (day %d, %.1f%%) → %s (day %d, %.1f%%)",
+		records[0].DateStr, records[0].DaysElapsed, records[0].Full,
+		records[len(records)-1].DateStr,
+		records[len(records)-1].DaysElapsed,
+		records[len(records)-1].Full)
+
+	// Debug: show sample trend values
+	if len(records) > 3 {
+		last := records[len(records)-1]
+		prev := records[len(records)-2]
+		log.Printf("     Last trend: %.3f%% (%.1f%% → %.1f%%), MA7: %.3f%%, EWMA: %.3f%%",
+			last.Trend, prev.Full, last.Full, last.TrendMA7, last.TrendEWMA)
+	}
+
+	return records, info, nil
+}
+
+// seedDays returns how many days before winter start to fetch for the
+// current season when SeedTrend is set, so its first trend values have
+// a history to build on. 0 disables seeding.
+func (o RecordOptions) seedDays() int {
+	if !o.SeedTrend {
+		return 0
+	}
+	return trendWindow
+}
+
+// calendarTrends fills Trend, TrendMA7 and TrendEWMA day over day.
+// The first record has no previous day, so its Trend stays 0 and is
+// left out of both averages; otherwise the early values would be
+// dragged towards zero.
+func calendarTrends(records []DayRecord, alpha float64) {
+	for i := range records {
+		if i == 0 {
+			continue
+		}
+		records[i].Trend = records[i].Full - records[i-1].Full
+		start := max(i-6, 1)
+		sum := 0.0
+		for j := start; j <= i; j++ {
+			sum += records[j].Trend
+		}
+		records[i].TrendMA7 = sum / float64(i-start+1)
+		if i == 1 {
+			records[i].TrendEWMA = records[i].Trend
+		} else {
+			records[i].TrendEWMA = alpha*records[i].Trend + (1-alpha)*records[i-1].TrendEWMA
+		}
+	}
+}
+
+// businessTrends fills Trend, TrendMA7 and TrendEWMA from weekdays
+// alone: a weekday's Trend is the change since the previous weekday,
+// so Monday compares against Friday, and the MA7 averages the last
+// seven weekday trends. Weekend days get a Trend of 0, their change
+// being counted on Monday, and carry the averages forward. Public
+// holidays are treated as business days.
+func businessTrends(records []DayRecord, alpha float64) {
+	prev := -1 // last weekday record
+	var trends []float64
+	for i := range records {
+		if wd := records[i].Date.Weekday(); wd == time.Saturday || wd == time.Sunday {
+			if i > 0 {
+				records[i].TrendMA7 = records[i-1].TrendMA7
+				records[i].TrendEWMA = records[i-1].TrendEWMA
+			}
+			continue
+		}
+		if prev >= 0 {
+			t := records[i].Full - records[prev].Full
+			records[i].Trend = t
+			trends = append(trends, t)
+			window := trends[max(len(trends)-7, 0):]
+			sum := 0.0
+			for _, v := range window {
+				sum += v
+			}
+			records[i].TrendMA7 = sum / float64(len(window))
+			if len(trends) == 1 {
+				records[i].TrendEWMA = t
+			} else {
+				records[i].TrendEWMA = alpha*t + (1-alpha)*records[prev].TrendEWMA
+			}
+		}
+		prev = i
+	}
+}
+
+// dedupeGasDays collapses records for the same gas day, which AGSI
+// occasionally returns for revised days, keeping the last one. records
+// must be sorted by date.
+func dedupeGasDays(records []DayRecord) []DayRecord {
+	out := records[:0]
+	for _, r := range records {
+		if n := len(out); n > 0 && out[n-1].Date.Equal(r.Date) {
+			out[n-1] = r
+			continue
+		}
+		out = append(out, r)
+	}
+	if dupes := len(records) - len(out); dupes > 0 {
+		log.Printf("     ⚠️  Collapsed %d duplicate gas days", dupes)
+	}
+	return out
+}
+
+// interpolateGaps fills runs of up to maxGap missing gas days with
+// linearly interpolated fill levels so the season overlays stay
+// aligned. Flows are unknown for those days and left at zero; the
+// records are flagged Interpolated. Larger gaps are left as-is.
+func interpolateGaps(records []DayRecord, maxGap int) []DayRecord {
+	if len(records) < 2 || maxGap < 1 {
+		return records
+	}
+	out := make([]DayRecord, 0, len(records))
+	filled := 0
+	for i, r := range records {
+		if i > 0 {
+			prev := records[i-1]
+			missing := r.DaysElapsed - prev.DaysElapsed - 1
+			if missing >= 1 && missing <= maxGap {
+				span := float64(missing + 1)
+				for k := 1; k <= missing; k++ {
+					frac := float64(k) / span
+					date := prev.Date.AddDate(0, 0, k)
+					out = append(out, DayRecord{
+						Date:             date,
+						DateStr:          date.Format("02 Jan 2006"),
+						Full:             prev.Full + (r.Full-prev.Full)*frac,
+						GasInStorage:     prev.GasInStorage + (r.GasInStorage-prev.GasInStorage)*frac,
+						WorkingGasVolume: prev.WorkingGasVolume,
+						DaysElapsed:      prev.DaysElapsed + k,
+						Interpolated:     true,
+					})
+				}
+				filled += missing
+			}
+		}
+		out = append(out, r)
+	}
+	if filled > 0 {
+		log.Printf("     🩹 Interpolated %d missing gas day(s)", filled)
+	}
+	return out
+}
+
+// displayLoc is the timezone gas days are interpreted and displayed
+// in, independent of where the server runs. It is the AGSI reference
+// zone Europe/Berlin until main applies DISPLAY_TZ from the Config.
+var displayLoc = mustLoadLocation(defaultDisplayTZ)
+
+// mustLoadLocation loads a zone from the embedded tzdata.
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// parseDate parses an AGSI date as a calendar day in displayLoc.
+func parseDate(s string) time.Time {
+	// Try common formats
+	formats := []string{
+		"2006-01-02",
+		"2006-01-02T15:04:05Z",
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		time.RFC3339,
+	}
+	for _, f := range formats {
+		if t, err := time.ParseInLocation(f, s, displayLoc); err == nil {
+			return t.In(displayLoc)
+		}
+	}
+	return time.Time{}
+}
+
+// checkFill clamps a fill percentage into [0,100] when it lies within
+// tol of the range. Values further out are implausible and ok is false;
+// the caller drops the record so interpolateGaps can bridge the day.
+func checkFill(v, tol float64) (full float64, ok bool) {
+	if v < -tol || v > 100+tol {
+		return v, false
+	}
+	return math.Min(math.Max(v, 0), 100), true
+}
+
+// parseFailures counts non-empty values parseFloat could not read.
+var parseFailures atomic.Int64
+
+// parseFloat reads an API number, accepting both "85.3" and the
+// European "85,3" as well as thousands separators ("1.234,5",
+// "1,234.5", "1 234,5"). Placeholders like "-" map to 0 silently;
+// anything else that fails to parse is logged and counted.
+func parseFloat(s string) float64 {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "-" || s == "N/A" {
+		return 0
+	}
+	v, err := strconv.ParseFloat(normalizeDecimal(s), 64)
+	if err != nil {
+		parseFailures.Add(1)
+		log.Printf("     ⚠️  Unparseable number %q treated as 0", s)
+		return 0
+	}
+	return v
+}
+
+// normalizeDecimal rewrites a localized number into the plain
+// dot-decimal form strconv understands. When both separators occur,
+// the last one is the decimal mark; a separator repeated several
+// times is a thousands separator.
+func normalizeDecimal(s string) string {
+	s = strings.NewReplacer(" ", "", "\u00a0", "", "'", "").Replace(s)
+	dot, comma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case dot >= 0 && comma >= 0:
+		if comma > dot {
+			s = strings.ReplaceAll(s, ".", "")
+			s = strings.Replace(s, ",", ".", 1)
+		} else {
+			s = strings.ReplaceAll(s, ",", "")
+		}
+	case comma >= 0:
+		if strings.Count(s, ",") > 1 {
+			s = strings.ReplaceAll(s, ",", "")
+		} else {
+			s = strings.Replace(s, ",", ".", 1)
+		}
+	case dot >= 0 && strings.Count(s, ".") > 1:
+		s = strings.ReplaceAll(s, ".", "")
+	}
+	return s
+}
+
+// ─── Sequential Fetch ───────────────────────────────────────
+
+// fetchAllSeasons loads every configured season for the country
+// aggregate or a single facility. Seasons that fail or come back empty
+// are skipped and described in warnings; their errors are joined into
+// err. Once ctx is done the remaining seasons are skipped the same
+// way. Only the aggregate is recorded in buildStatus.
+func fetchAllSeasons(ctx context.Context, c Config, configs []SeasonConfig, fac Facility) (allSeasons map[int][]DayRecord, seasons []SeasonData, warnings []string, err error) {
+	allSeasons = make(map[int][]DayRecord)
+	var errs []error
+
+	cal := c.Calendar
+	cwsy := cal.CurrentStartYear()
+	seasonCache.resetIfRolledOver(cwsy)
+	aggregate := fac.IsZero()
+	if aggregate {
+		buildStatus.resetSeasons()
+	}
+	fetched := false
+
+	// With BATCH_FETCH=1, load every season missing from the cache in
+	// one go; if that fails, fall back to fetching them one by one.
+	var batched map[int][]DayRecord
+	var batchInfo map[int]FetchInfo
+	if bs, ok := activeSource.(batchSource); c.BatchFetch && ok {
+		var missing []int
+		for _, cfg := range configs {
+			if _, ok := seasonCache.Get(fac, cfg.Year); !ok && cal.ValidateYear(cfg.Year) == nil {
+				missing = append(missing, cfg.Year)
+			}
+		}
+		if b, bi, err := bs.FetchSeasons(ctx, missing, fac); err != nil {
+			log.Printf("  ⚠️  Batched fetch failed, fetching per season: %v", err)
+		} else {
+			batched, batchInfo = b, bi
+			fetched = true
+		}
+	}
+
+	for i, cfg := range configs {
+		log.Printf("\n── Season %d/%d: %s ──", i+1, len(configs), cfg.Name)
+
+		if records, ok := seasonCache.Get(fac, cfg.Year); ok {
+			log.Printf("  📦 %s: %d records from season cache", cfg.Name, len(records))
+			allSeasons[cfg.Year] = records
+			seasons = append(seasons, SeasonData{Config: cfg, Records: records})
+			if aggregate {
+				buildStatus.recordSeason(cfg, len(records), FetchInfo{Source: "cache"}, nil)
+			}
+			continue
+		}
+
+		var records []DayRecord
+		var info FetchInfo
+		err := ctx.Err()
+		switch {
+		case err != nil:
+		case batched != nil:
+			records, info = batched[cfg.Year], batchInfo[cfg.Year]
+			if len(records) == 0 {
+				err = ErrEmptyData
+			}
+		default:
+			if fetched {
+				err = sleepCtx(ctx, apiLatency.Delay())
+			}
+			fetched = true
+			if err == nil {
+				records, info, err = fetchSeasonWithRetry(ctx, cal, cfg.Year, fac)
+			}
+		}
+		if err == nil {
+			if records = cal.TrimAsOf(records); len(records) == 0 {
+				err = ErrEmptyData
+			}
+		}
+		if aggregate {
+			buildStatus.recordSeason(cfg, len(records), info, err)
+		}
+		switch {
+		case errors.Is(err, ErrEmptyData):
+			log.Printf("  ⚠️  %s: no data (skipping)", cfg.Name)
+			warnings = append(warnings, fmt.Sprintf("%s returned no data", cfg.Name))
+			errs = append(errs, fmt.Errorf("%s: %w", cfg.Name, err))
+		case err != nil:
+			log.Printf("  ❌ %s: %v (skipping)", cfg.Name, err)
+			warnings = append(warnings, fmt.Sprintf("%s failed to load: %v", cfg.Name, err))
+			errs = append(errs, fmt.Errorf("%s: %w", cfg.Name, err))
+		default:
+			log.Printf("  ✅ %s: %d records loaded", cfg.Name, len(records))
+			allSeasons[cfg.Year] = records
+			seasons = append(seasons, SeasonData{Config: cfg, Records: records})
+			// Past winters are final; only the current one keeps changing.
+			if cfg.Year < cwsy {
+				seasonCache.Set(fac, cfg.Year, records)
+			}
+		}
+	}
+
+	return allSeasons, seasons, warnings, errors.Join(errs...)
+}
+
+// ─── Batched Fetch ──────────────────────────────────────────
+
+// fetchSeasonsBatched fetches the whole span of the given season years
+// in a single (paginated) query and splits it into seasons locally.
+// Years without records are absent from the result.
+func fetchSeasonsBatched(ctx context.Context, a agsiSource, years []int, fac Facility) (map[int][]DayRecord, map[int]FetchInfo, error) {
+	if len(years) == 0 {
+		return nil, nil, nil
+	}
+	years = slices.Sorted(slices.Values(years))
+	first, last := years[0], years[len(years)-1]
+	cwsy := a.cal.CurrentStartYear()
+
+	start, _ := time.ParseInLocation("2006-01-02",
+		a.cal.StartDate(first), displayLoc)
+	if days := a.opts.seedDays(); days > 0 && first == cwsy {
+		start = start.AddDate(0, 0, -days)
+	}
+	endDate := a.cal.EndDate(last)
+	if last == cwsy {
+		endDate = a.cal.Now().Format("2006-01-02")
+	}
+	fromDate := start.Format("2006-01-02")
+	log.Printf("  📡 Batched fetch of %d seasons: %s → %s", len(years), fromDate, endDate)
+
+	var all []APIRecord
+	var elapsed time.Duration
+	for page := 1; ; page++ {
+		if page > maxBatchPages {
+			return nil, nil, fmt.Errorf("batched fetch exceeded %d pages", maxBatchPages)
+		}
+		if page > 1 {
+			if err := sleepCtx(ctx, apiLatency.Delay()); err != nil {
+				return nil, nil, err
+			}
+		}
+		req, err := a.newRequest(ctx, fmt.Sprintf("%s&page=%d", a.queryURL(fromDate, endDate, fac), page))
+		if err != nil {
+			return nil, nil, err
+		}
+		sent := time.Now()
+		resp, err := apiClient.Do(req)
+		apiLatency.Record(time.Since(sent))
+		if err != nil {
+			return nil, nil, fmt.Errorf("HTTP request: %w", err)
+		}
+		body, err := readAPIBody(resp, a.maxBody)
+		resp.Body.Close()
+		elapsed += time.Since(sent)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Printf("     page %d: HTTP %d, %d bytes", page, resp.StatusCode, len(body))
+		if resp.StatusCode != http.StatusOK {
+			return nil, nil, &APIStatusError{Code: resp.StatusCode, Body: string(body[:min(len(body), 500)])}
+		}
+		if err := checkJSONBody(resp, body); err != nil {
+			return nil, nil, err
+		}
+		apiResp, err := decodeAPIResponse(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		all = append(all, apiResp.Data...)
+		if !morePages(page, apiResp) {
+			break
+		}
+	}
+
+	out := make(map[int][]DayRecord)
+	infos := make(map[int]FetchInfo)
+	for year, data := range partitionBySeason(a.cal, a.opts.seedDays(), all, years) {
+		records, info, err := seasonRecords(a.cal, a.opts, year, data, fac)
+		info.Source, info.HTTPStatus = "batch", http.StatusOK
+		info.BatchDurationMs = elapsed.Milliseconds()
+		infos[year] = info
+		if err != nil {
+			log.Printf("  ⚠️  %s from batch: %v", a.cal.Label(year), err)
+			continue
+		}
+		out[year] = records
+	}
+	return out, infos, nil
+}
+
+// morePages reports whether another page follows page. AGSI's
+// last_page decides when present, so the loop never asks for a page
+// past it; without it, a short or empty page is the last one.
+func morePages(page int, resp APIResponse) bool {
+	if resp.LastPage > 0 {
+		return page < resp.LastPage
+	}
+	return len(resp.Data) >= fetchSize
+}
+
+// partitionBySeason assigns raw records to the given winters by gas
+// day: from winter start to the target end date, plus the seed days
+// before the current winter when SEED_TREND is on. Records outside any
+// requested window are dropped.
+func partitionBySeason(cal Calendar, seed int, data []APIRecord, years []int) map[int][]APIRecord {
+	cwsy := cal.CurrentStartYear()
+	out := make(map[int][]APIRecord)
+	for _, r := range data {
+		date := parseDate(r.GasDayStart)
+		if date.IsZero() {
+			continue
+		}
+		for _, y := range years {
+			start, _ := time.ParseInLocation("2006-01-02",
+				cal.StartDate(y), displayLoc)
+			end, _ := time.ParseInLocation("2006-01-02",
+				cal.EndDate(y), displayLoc)
+			if y == cwsy {
+				start = start.AddDate(0, 0, -seed)
+			}
+			if !date.Before(start) && !date.After(end) {
+				out[y] = append(out[y], r)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// cachedSeason returns the aggregate records for one season year if
+// the latest dashboard or the season cache already holds them. With
+// WINTER_START=detect the season cache's calendar-based records are
+// anchored at their pivot, like the dashboard's.
+func cachedSeason(cal Calendar, year int) ([]DayRecord, bool) {
+	if data := cache.Latest(); data != nil {
+		if r, ok := data.seasonMap()[year]; ok {
+			return r, true
+		}
+	}
+	seasonCache.resetIfRolledOver(cal.CurrentStartYear())
+	r, ok := seasonCache.Get(Facility{}, year)
+	if ok && detectWinterStart(cal) {
+		if anchored, _ := anchorAtPivot(r, cal.PivotRunDays); len(anchored) > 0 {
+			r = anchored
+		}
+	}
+	return r, ok
+}
+
+// SeasonWarmer fetches single past seasons on demand, outside the
+// dashboard build lock, so endpoints like /api/compare can answer
+// "warming" instead of blocking on AGSI. Each year is fetched at most
+// once at a time; the result lands in the season cache.
+type SeasonWarmer struct {
+	mu       sync.Mutex
+	inflight map[int]chan struct{}
+	errs     map[int]error
+}
+
+var warmer = &SeasonWarmer{
+	inflight: make(map[int]chan struct{}),
+	errs:     make(map[int]error),
+}
+
+// Load returns the season if it is cached or can be fetched within
+// wait. ok is false while the fetch is still running in the
+// background. A failed fetch is reported once and retried by the next
+// call. The current season is never fetched here: it arrives with the
+// next dashboard build.
+func (sw *SeasonWarmer) Load(cal Calendar, year int, wait time.Duration) (records []DayRecord, ok bool, err error) {
+	if r, ok := cachedSeason(cal, year); ok {
+		return r, true, nil
+	}
+	if year >= cal.CurrentStartYear() {
+		return nil, false, nil
+	}
+
+	sw.mu.Lock()
+	if err := sw.errs[year]; err != nil {
+		delete(sw.errs, year)
+		sw.mu.Unlock()
+		return nil, false, err
+	}
+	done, running := sw.inflight[year]
+	if !running {
+		done = make(chan struct{})
+		sw.inflight[year] = done
+		go sw.fetch(cal, year, done)
+	}
+	sw.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(wait):
+		return nil, false, nil
+	}
+	if r, ok := cachedSeason(cal, year); ok {
+		return r, true, nil
+	}
+	sw.mu.Lock()
+	err = sw.errs[year]
+	delete(sw.errs, year)
+	sw.mu.Unlock()
+	return nil, false, err
+}
+
+func (sw *SeasonWarmer) fetch(cal Calendar, year int, done chan struct{}) {
+	log.Printf("  🔥 Warming season %s", cal.Label(year))
+	records, _, err := fetchSeason(context.Background(), cal, year, Facility{})
+
+	sw.mu.Lock()
+	if err != nil {
+		log.Printf("  ❌ Warming %d failed: %v", year, err)
+		sw.errs[year] = err
+	} else {
+		seasonCache.Set(Facility{}, year, records)
+	}
+	delete(sw.inflight, year)
+	sw.mu.Unlock()
+	close(done)
+}
+
+// ─── Units ──────────────────────────────────────────────────
+
+const (
+	unitsPercent = "percent"
+	unitsTWh     = "twh"
+)
+
+// toUnits returns the records with Full expressed in units, plus the critical level in those units. In TWh mode Full is
+// replaced by GasInStorage and the critical level is critical percent
+// of the latest working gas volume. If any record lacks absolute
+// volumes the records are returned unchanged in percent and absolute
+// is false.
+func toUnits(records []DayRecord, units string, critical float64) (out []DayRecord, crit float64, absolute bool) {
+	if units != unitsTWh || len(records) == 0 {
+		return records, critical, false
+	}
+	out = make([]DayRecord, len(records))
+	for i, r := range records {
+		if r.GasInStorage <= 0 || r.WorkingGasVolume <= 0 {
+			return records, critical, false
+		}
+		r.Full = r.GasInStorage
+		out[i] = r
+	}
+	last := records[len(records)-1]
+	return out, critical / 100 * last.WorkingGasVolume, true
+}
+
+// ─── Scenarios ──────────────────────────────────────────────
+
+// stressColors are assigned to Stress scenarios in order of
+// increasing multiplier.
+var stressColors = []string{"#800000", "#6c3483", "#1a5276", "#4d5656"}
+
+// scenarioMinDays returns how many days of current-season data the
+// projections need: the full fit window, unless MIN_SCENARIO_DAYS (n)
+// lowers it for earlier, lower-confidence projections fitted over
+// whatever is available.
+func scenarioMinDays(window, n int) int {
+	if n == 0 {
+		return window
+	}
+	return min(n, window)
+}
+
+// projectionOffset returns how many of the most recent days
+// PROJECTION_OFFSET_DAYS leaves out of the projections, e.g. when the
+// last AGSI value is known to be provisional. Both settings count from
+// the latest gas day: the PROVISIONAL_DAYS already dropped from the
+// analysis records count towards the offset instead of adding to it.
+func projectionOffset(c Config) int {
+	return max(c.ProjectionOffset-c.ProvisionalDays, 0)
+}
+
+// generateScenarios projects the current season forward, up to
+// c.MaxProjectionDays and against the c.Critical level. window is
+// the number of most recent days the linear fit uses. When there is
+// too little data to project, it returns no scenarios and the reason.
+func generateScenarios(c Config, current []DayRecord, allSeasons map[int][]DayRecord,
+	currentStartYear, window int) ([]Scenario, string) {
+
+	if off := projectionOffset(c); off > 0 {
+		current = current[:max(len(current)-off, 0)]
+	}
+	if need := scenarioMinDays(window, c.MinScenarioDays); len(current) < need {
+		log.Printf("  ⚠️  Not enough data for scenarios (%d < %d)",
+			len(current), need)
+		return nil, fmt.Sprintf("Projections need %d days of current-season data, only %d available.",
+			need, len(current))
+	}
+
+	current, crit, absolute := toUnits(current, c.Units, c.Critical)
+
+	lastIdx := len(current) - 1
+	currentVal := current[lastIdx].Full
+	currentDay := current[lastIdx].DaysElapsed
+	lastDate := current[lastIdx].Date
+	origin := lastDate.Format("02.01.2006")
+
+	var scenarios []Scenario
+
+	recentStart := max(len(current)-window, 0)
+	fit, fitName := regressionFunc(c)
+	slope, _, r2 := fit(current[recentStart:])
+	// A fit over less than the full window is low confidence regardless of R².
+	lowConfidence := r2 < c.R2Threshold || len(current) < window
+	unit := "%"
+	if absolute {
+		unit = " TWh"
+	}
+	log.Printf("  📈 Slope: %.4f%s/day over %d days (%s), R² %.3f", slope, unit, len(current[recentStart:]), fitName, r2)
+
+	maxDays := float64(c.MaxProjectionDays)
+
+	// Each projection also reports the fill it reaches at the season's
+	// target end date. PROJECT_TO_SEASON_END=1 keeps trends that never
+	// reach the critical level, drawn up to that date instead.
+	toEnd := float64(c.Calendar.Days(currentStartYear) - 1 - currentDay)
+	endFill := func(slope float64) *float64 {
+		if toEnd < 0 {
+			return nil
+		}
+		v := max(currentVal+slope*toEnd, 0)
+		return &v
+	}
+	if c.Calendar.Summer {
+		return refillScenarios(c, current, slope, r2, lowConfidence, toEnd, maxDays, absolute)
+	}
+
+	// PROJECTION_HORIZON=season stops every projection at the target
+	// end date; trends that are still above the critical level there
+	// survive the season and are drawn up to it. A crossing before the
+	// end date but beyond MAX_PROJECTION_DAYS is just out of range.
+	capped := c.SeasonHorizon && toEnd > 0
+	if capped {
+		maxDays = min(maxDays, toEnd)
+	}
+	toSeasonEnd := (c.ProjectToSeasonEnd || capped) && toEnd > 0
+	linearToEnd := func() Scenario {
+		return Scenario{
+			Name: "Linear", Label: "📉 Linear Trend",
+			Color: "#c0392b", Dash: "dot",
+			Points:          c.projectionPoints(currentDay, currentVal, slope, toEnd, lastDate),
+			Slope:           slope,
+			R2:              r2,
+			LowConfidence:   lowConfidence,
+			Origin:          origin,
+			EndOfSeasonFill: endFill(slope),
+			SurvivesSeason:  true,
+		}
+	}
+
+	if slope < 0 {
+		days := (crit - currentVal) / slope
+		if days > maxDays {
+			survives := days > toEnd
+			if capped && survives {
+				log.Printf("  📉 Linear: ~%.0f days, survives the season", days)
+			} else {
+				log.Printf("  📉 Linear: ~%.0f days exceeds %.0f-day horizon, skipping", days, maxDays)
+			}
+			if toSeasonEnd && survives {
+				scenarios = append(scenarios, linearToEnd())
+			}
+		} else {
+			hitDate := lastDate.Add(time.Duration(days*24) * time.Hour)
+			scenarios = append(scenarios, Scenario{
+				Name: "Linear", Label: "📉 Linear Trend",
+				Color: "#c0392b", Dash: "dot",
+				Points:          c.projectionPoints(currentDay, currentVal, slope, days, lastDate),
+				HitDate:         hitDate.Format("02.01.2006"),
+				Slope:           slope,
+				DaysLeft:        int(days),
+				R2:              r2,
+				LowConfidence:   lowConfidence,
+				Origin:          origin,
+				EndOfSeasonFill: endFill(slope),
+			})
+			log.Printf("  📉 Linear: ~%d days → %s", int(days), hitDate.Format("02 Jan 2006"))
+		}
+
+		multipliers := c.StressMultipliers
+		for i, m := range multipliers {
+			ss := slope * m
+			sd := (crit - currentVal) / ss
+			label := "❄️ Severe Winter"
+			if len(multipliers) > 1 {
+				label = fmt.Sprintf("❄️ Severe ×%g", m)
+			}
+			if sd > maxDays {
+				survives := sd > toEnd
+				if capped && survives {
+					log.Printf("  ❄️  Stress ×%g: ~%.0f days, survives the season", m, sd)
+				} else {
+					log.Printf("  ❄️  Stress ×%g: ~%.0f days exceeds %.0f-day horizon, skipping", m, sd, maxDays)
+				}
+				if toSeasonEnd && survives {
+					scenarios = append(scenarios, Scenario{
+						Name: "Stress", Label: label,
+						Color: stressColors[i%len(stressColors)], Dash: "dashdot",
+						Points:          c.projectionPoints(currentDay, currentVal, ss, toEnd, lastDate),
+						Slope:           ss,
+						Multiplier:      m,
+						R2:              r2,
+						LowConfidence:   lowConfidence,
+						Origin:          origin,
+						EndOfSeasonFill: endFill(ss),
+						SurvivesSeason:  true,
+					})
+				}
+				continue
+			}
+			shd := lastDate.Add(time.Duration(sd*24) * time.Hour)
+			scenarios = append(scenarios, Scenario{
+				Name: "Stress", Label: label,
+				Color: stressColors[i%len(stressColors)], Dash: "dashdot",
+				Points:          c.projectionPoints(currentDay, currentVal, ss, sd, lastDate),
+				HitDate:         shd.Format("02.01.2006"),
+				Slope:           ss,
+				DaysLeft:        int(sd),
+				Multiplier:      m,
+				R2:              r2,
+				LowConfidence:   lowConfidence,
+				Origin:          origin,
+				EndOfSeasonFill: endFill(ss),
+			})
+			log.Printf("  ❄️  Stress ×%g: ~%d days → %s", m, int(sd), shd.Format("02 Jan 2006"))
+		}
+	}
+
+	if toSeasonEnd && slope >= 0 {
+		scenarios = append(scenarios, linearToEnd())
+	}
+
+	// Historical — use the season before current
+	histYear := currentStartYear - 1
+	recs, ok := allSeasons[histYear]
+	if ok && absolute {
+		// Only shape the projection in TWh when history has TWh too.
+		recs, _, ok = toUnits(recs, c.Units, c.Critical)
+	}
+	if ok && len(recs) > 0 {
+		var pts []ScenarioPoint
+		var base float64
+		found := false
+		for _, r := range recs {
+			if r.DaysElapsed > currentDay {
+				if !found {
+					base = r.Full
+					found = true
+				}
+				pts = append(pts, ScenarioPoint{
+					X:         float64(r.DaysElapsed),
+					Y:         currentVal + (r.Full - base),
+					HoverDate: r.Date.Format("02 Jan"),
+				})
+			}
+		}
+		// The historical shape only covers days the past season has.
+		endDay := float64(c.Calendar.Days(currentStartYear) - 1)
+		if capped {
+			pts = slices.DeleteFunc(pts, func(p ScenarioPoint) bool { return p.X > endDay })
+		}
+		if len(pts) > 0 {
+			sc := Scenario{
+				Name:  "History",
+				Label: "📅 Like " + c.Calendar.Label(histYear),
+				Color: "#d35400", Dash: "dash",
+				Points: pts,
+				Origin: origin,
+			}
+			for _, p := range pts {
+				if p.X <= endDay && endDay-p.X <= 1 {
+					v := max(p.Y, 0)
+					sc.EndOfSeasonFill = &v
+				}
+			}
+			if days, ok := thresholdCrossing(pts, currentDay, currentVal, crit); ok {
+				hitDate := lastDate.Add(time.Duration(days*24) * time.Hour)
+				sc.HitDate = hitDate.Format("02.01.2006")
+				sc.DaysLeft = int(days)
+				log.Printf("  📅 History: ~%d days → %s", int(days), hitDate.Format("02 Jan 2006"))
+			} else if capped {
+				sc.SurvivesSeason = true
+			}
+			scenarios = append(scenarios, sc)
+			log.Printf("  📅 History: %d points from %s",
+				len(pts), c.Calendar.Label(histYear))
+		}
+	}
+
+	return scenarios, ""
+}
+
+// refillScenarios are the injection season's projections: "Refill"
+// extends the current trend up to the refill target (or the season end
+// if it gets there later), "Required" is the pace that reaches the
+// target exactly on the season's end date. toEnd is the number of days
+// left until then, maxDays the projection horizon.
+func refillScenarios(c Config, current []DayRecord, slope, r2 float64, lowConfidence bool,
+	toEnd, maxDays float64, absolute bool) ([]Scenario, string) {
+	last := current[len(current)-1]
+	currentVal, currentDay, lastDate := last.Full, last.DaysElapsed, last.Date
+	origin := lastDate.Format("02.01.2006")
+	target, full := c.RefillTarget, 100.0
+	if absolute {
+		target, full = target/100*last.WorkingGasVolume, last.WorkingGasVolume
+	}
+	if currentVal >= target {
+		log.Printf("  🎯 Refill target %.0f%% already reached", c.RefillTarget)
+		return nil, fmt.Sprintf("Storage has reached the %.0f%% refill target.", c.RefillTarget)
+	}
+	endFill := func(slope float64) *float64 {
+		if toEnd < 0 {
+			return nil
+		}
+		v := min(max(currentVal+slope*toEnd, 0), full)
+		return &v
+	}
+
+	var scenarios []Scenario
+	trend := Scenario{
+		Name: "Refill", Label: "📈 Refill Trend",
+		Color: "#16a34a", Dash: "dot",
+		Slope:           slope,
+		R2:              r2,
+		LowConfidence:   lowConfidence,
+		Origin:          origin,
+		EndOfSeasonFill: endFill(slope),
+	}
+	if days := (target - currentVal) / slope; slope > 0 && days <= maxDays {
+		hitDate := lastDate.Add(time.Duration(days*24) * time.Hour)
+		trend.Points = c.projectionPoints(currentDay, currentVal, slope, days, lastDate)
+		trend.HitDate = hitDate.Format("02.01.2006")
+		trend.DaysLeft = int(days)
+		log.Printf("  📈 Refill: %.0f%% in ~%d days → %s", c.RefillTarget, int(days), hitDate.Format("02 Jan 2006"))
+	} else if toEnd > 0 {
+		trend.Points = c.projectionPoints(currentDay, currentVal, slope, toEnd, lastDate)
+		log.Printf("  📈 Refill: %.0f%% not reached by season end at current trend", c.RefillTarget)
+	}
+	if trend.Points != nil {
+		scenarios = append(scenarios, trend)
+	}
+
+	if toEnd > 0 {
+		need := (target - currentVal) / toEnd
+		end := lastDate.AddDate(0, 0, int(toEnd))
+		scenarios = append(scenarios, Scenario{
+			Name: "Required", Label: fmt.Sprintf("🎯 Needed for %.0f%%", c.RefillTarget),
+			Color: "#7c3aed", Dash: "dash",
+			Points:          c.projectionPoints(currentDay, currentVal, need, toEnd, lastDate),
+			HitDate:         end.Format("02.01.2006"),
+			Slope:           need,
+			DaysLeft:        int(toEnd),
+			Origin:          origin,
+			EndOfSeasonFill: endFill(need),
+		})
+		unit := "%"
+		if absolute {
+			unit = " TWh"
+		}
+		log.Printf("  🎯 Required: %.3f%s/day (trend %.3f%s/day)", need, unit, slope, unit)
+	}
+	return scenarios, ""
+}
+
+// thresholdCrossing returns the days after currentDay at which the
+// projected points first fall to crit, interpolating between the
+// two points that straddle it.
+func thresholdCrossing(pts []ScenarioPoint, currentDay int, currentVal, crit float64) (float64, bool) {
+	prevX, prevY := float64(currentDay), currentVal
+	for _, p := range pts {
+		if p.Y <= crit {
+			x := p.X
+			if prevY != p.Y {
+				x = prevX + (p.X-prevX)*(prevY-crit)/(prevY-p.Y)
+			}
+			return x - float64(currentDay), true
+		}
+		prevX, prevY = p.X, p.Y
+	}
+	return 0, false
+}
+
+// projectionPoints projects slope from startDay over totalDays,
+// sampled as PROJECTION_POINT_STEP and PROJECTION_SAMPLING ask.
+func (c Config) projectionPoints(startDay int, startVal, slope, totalDays float64,
+	startDate time.Time) []ScenarioPoint {
+	return makeProjectionPoints(startDay, startVal, slope, totalDays, startDate,
+		projectionPointCount(totalDays, c.PointStep), c.DailySampling)
+}
+
+// projectionPointCount returns one point every step days of
+// projection, clamped to a sane range.
+func projectionPointCount(totalDays, step float64) int {
+	n := int(math.Ceil(totalDays/step)) + 1
+	return min(max(n, minProjectionPoints), maxProjectionPoints)
+}
+
+// makeProjectionPoints spreads n points evenly over totalDays; the
+// first lands on startDay and the last exactly on the crossing day.
+// With daily sampling, on whole gas days aligned with the axis ticks,
+// see dailyProjectionPoints.
+func makeProjectionPoints(startDay int, startVal, slope, totalDays float64,
+	startDate time.Time, n int, daily bool) []ScenarioPoint {
+	n = max(n, 2)
+	if daily {
+		return dailyProjectionPoints(startDay, startVal, slope, totalDays, startDate, n)
+	}
+	pts := make([]ScenarioPoint, n)
+	for i := 0; i < n; i++ {
+		d := totalDays * float64(i) / float64(n-1)
+		// Whole days by calendar, so a DST switch in between doesn't
+		// pull the date back to 23:00 the day before.
+		whole := math.Floor(d)
+		date := startDate.AddDate(0, 0, int(whole)).Add(time.Duration((d - whole) * 24 * float64(time.Hour)))
+		pts[i] = ScenarioPoint{
+			X:         float64(startDay) + d,
+			Y:         startVal + slope*d,
+			HoverDate: date.Format("02 Jan 2006"),
+		}
+	}
+	return pts
+}
+
+// dailyProjectionPoints places points on whole days from startDay, at
+// most n of them, always including the day the projection crosses
+// (the HitDate). A crossing between two days gets one more point at
+// the exact crossing so the line still reaches the critical level.
+func dailyProjectionPoints(startDay int, startVal, slope, totalDays float64,
+	startDate time.Time, n int) []ScenarioPoint {
+	last := int(math.Floor(totalDays))
+	step := max(int(math.Ceil(float64(last)/float64(n-1))), 1)
+	pts := make([]ScenarioPoint, 0, last/step+3)
+	add := func(d float64, date time.Time) {
+		pts = append(pts, ScenarioPoint{
+			X:         float64(startDay) + d,
+			Y:         startVal + slope*d,
+			HoverDate: date.Format("02 Jan 2006"),
+		})
+	}
+	for k := 0; k < last; k += step {
+		add(float64(k), startDate.AddDate(0, 0, k))
+	}
+	add(float64(last), startDate.AddDate(0, 0, last))
+	if frac := totalDays - float64(last); frac > 1e-9 {
+		add(totalDays, startDate.AddDate(0, 0, last))
+	}
+	return pts
+}
+
+// linearRegression fits an ordinary least-squares line through the
+// fill levels and reports its coefficient of determination R².
+func linearRegression(records []DayRecord) (slope, intercept, r2 float64) {
+	n := float64(len(records))
+	if n < 2 {
+		return 0, 0, 0
+	}
+	// Sums are taken around the means: n·Σx² − (Σx)² loses precision
+	// to cancellation once DaysElapsed gets large.
+	var mx, my float64
+	for _, r := range records {
+		mx += float64(r.DaysElapsed)
+		my += r.Full
+	}
+	mx /= n
+	my /= n
+	var sxx, sxy float64
+	for _, r := range records {
+		dx := float64(r.DaysElapsed) - mx
+		sxx += dx * dx
+		sxy += dx * (r.Full - my)
+	}
+	if sxx < 1e-10 {
+		return 0, my, 0
+	}
+	slope = sxy / sxx
+	intercept = my - slope*mx
+	r2 = rSquared(records, slope, intercept, nil)
+	return
+}
+
+// rSquared returns 1 - SSres/SStot for the fitted line, optionally
+// weighting each record. A perfectly flat series that the line
+// matches exactly counts as a perfect fit.
+func rSquared(records []DayRecord, slope, intercept float64, weight func(DayRecord) float64) float64 {
+	var sw, sy float64
+	for _, r := range records {
+		w := 1.0
+		if weight != nil {
+			w = weight(r)
+		}
+		sw += w
+		sy += w * r.Full
+	}
+	mean := sy / sw
+	var ssRes, ssTot float64
+	for _, r := range records {
+		w := 1.0
+		if weight != nil {
+			w = weight(r)
+		}
+		pred := intercept + slope*float64(r.DaysElapsed)
+		ssRes += w * (r.Full - pred) * (r.Full - pred)
+		ssTot += w * (r.Full - mean) * (r.Full - mean)
+	}
+	if ssTot < 1e-12 {
+		if ssRes < 1e-12 {
+			return 1
+		}
+		return 0
+	}
+	return 1 - ssRes/ssTot
+}
+
+// weightedLinearRegression fits a least-squares line where each day
+// is weighted by 0.5^(age/halfLife), age being the number of days
+// before the most recent record. The latest day has weight 1, a day
+// halfLife days older weight 0.5, and so on.
+func weightedLinearRegression(records []DayRecord, halfLife float64) (slope, intercept, r2 float64) {
+	if len(records) < 2 {
+		return 0, 0, 0
+	}
+	latest := float64(records[len(records)-1].DaysElapsed)
+	weight := func(r DayRecord) float64 {
+		return math.Pow(0.5, (latest-float64(r.DaysElapsed))/halfLife)
+	}
+	// Centered on the weighted means, as in linearRegression.
+	var sw, mx, my float64
+	for _, r := range records {
+		w := weight(r)
+		sw += w
+		mx += w * float64(r.DaysElapsed)
+		my += w * r.Full
+	}
+	mx /= sw
+	my /= sw
+	var sxx, sxy float64
+	for _, r := range records {
+		w := weight(r)
+		dx := float64(r.DaysElapsed) - mx
+		sxx += w * dx * dx
+		sxy += w * dx * (r.Full - my)
+	}
+	if sxx < 1e-10 {
+		return 0, my, 0
+	}
+	slope = sxy / sxx
+	intercept = my - slope*mx
+	r2 = rSquared(records, slope, intercept, weight)
+	return
+}
+
+// regressionFunc selects the trend fit: linear, or with
+// REGRESSION=weighted one whose weights decay with a half-life of
+// REGRESSION_HALF_LIFE days.
+func regressionFunc(c Config) (func([]DayRecord) (float64, float64, float64), string) {
+	if !c.WeightedFit {
+		return linearRegression, "linear"
+	}
+	halfLife := c.HalfLife
+	return func(r []DayRecord) (float64, float64, float64) {
+		return weightedLinearRegression(r, halfLife)
+	}, fmt.Sprintf("weighted, half-life %gd", halfLife)
+}
+
+// ─── KPI ────────────────────────────────────────────────────
+
+// originLag returns how many days the projection origin, which
+// PROJECTION_OFFSET_DAYS puts before the latest gas day, lags behind
+// it. Subtracting it turns a scenario's DaysLeft into days from the
+// latest gas day.
+func originLag(c Config, records []DayRecord) int {
+	off := min(projectionOffset(c), len(records)-1)
+	if off <= 0 {
+		return 0
+	}
+	return records[len(records)-1].DaysElapsed - records[len(records)-1-off].DaysElapsed
+}
+
+func buildKPI(c Config, records []DayRecord, scenarios []Scenario) KPIData {
+	records, crit, absolute := toUnits(records, c.Units, c.Critical)
+	last := records[len(records)-1]
+	kpi := KPIData{
+		CurrentFill:          last.Full,
+		CurrentDate:          last.Date.Format("02 Jan 2006"),
+		DaysToCrit:           999,
+		DaysToCritHistorical: 999,
+		DaysToTarget:         999,
+	}
+	if len(records) >= 7 {
+		kpi.Delta7D = last.Full - records[len(records)-7].Full
+	}
+	if last.GasInStorage > 0 {
+		kpi.CurrentFillTWh, kpi.TWhAvailable = last.GasInStorage, true
+		if len(records) >= 7 && records[len(records)-7].GasInStorage > 0 {
+			kpi.Delta7DTWh = last.GasInStorage - records[len(records)-7].GasInStorage
+		}
+	}
+	start := len(records) - 7
+	if start < 0 {
+		start = 0
+	}
+	sum, inj := 0.0, 0.0
+	for _, r := range records[start:] {
+		sum += r.Withdrawal
+		inj += r.Injection
+	}
+	kpi.AvgWithdrawal = sum / float64(len(records)-start)
+	avgInjection := inj / float64(len(records)-start)
+
+	wdStart := max(len(records)-weekdayWindow, 0)
+	wdSum, wdCount := 0.0, 0
+	for _, r := range records[wdStart:] {
+		if wd := r.Date.Weekday(); wd == time.Saturday || wd == time.Sunday {
+			continue
+		}
+		wdSum += r.Withdrawal
+		wdCount++
+	}
+	if wdCount > 0 {
+		kpi.AvgWithdrawalWeekday = wdSum / float64(wdCount)
+	}
+
+	// The KPIs count from the latest gas day, the scenarios from their
+	// origin.
+	lag := originLag(c, records)
+	for _, s := range scenarios {
+		if s.Name == "Linear" || s.Name == "Refill" {
+			kpi.TrendR2 = s.R2
+			kpi.TrendLowConfidence = s.LowConfidence
+		}
+		if s.Name == "Refill" && s.DaysLeft > 0 {
+			kpi.DaysToTarget = max(s.DaysLeft-lag, 0)
+		}
+		if s.Name == "Linear" && s.DaysLeft > 0 {
+			kpi.DaysToCrit = max(s.DaysLeft-lag, 0)
+		}
+		if s.Name == "Linear" && s.SurvivesSeason {
+			kpi.SurvivesSeason = true
+		}
+		if s.Name == "History" && s.DaysLeft > 0 {
+			kpi.DaysToCritHistorical = max(s.DaysLeft-lag, 0)
+		}
+	}
+	kpi.DaysToCritWithdrawal = daysToCritWithdrawal(last, crit, absolute, kpi.AvgWithdrawal)
+	kpi.DaysToEmpty = daysToEmpty(last, kpi.AvgWithdrawal-avgInjection, scenarios)
+	kpi.DataAgeHours, kpi.Stale = dataAge(c, last.Date)
+	return kpi
+}
+
+// ─── Drawdown Alert ─────────────────────────────────────────
+
+// DrawdownAlert tracks whether the current season is in a rapid
+// drawdown: the fill fell more than RAPID_DRAWDOWN_PCT percentage
+// points over 7 days. Once tripped it only clears after the drop eases
+// by RAPID_DRAWDOWN_HYSTERESIS points, so it doesn't flap around the
+// threshold. Tripping posts to ALERT_WEBHOOK_URL when set.
+type DrawdownAlert struct {
+	threshold  float64
+	hysteresis float64
+	webhook    string
+
+	mu     sync.Mutex
+	active bool
+}
+
+// drawdownAlert watches the aggregate. main replaces it with one set
+// up from the Config.
+var drawdownAlert = newDrawdownAlert(defaultDrawdownPct, defaultDrawdownHysteresis, "")
+
+func newDrawdownAlert(threshold, hysteresis float64, webhook string) *DrawdownAlert {
+	return &DrawdownAlert{threshold: threshold, hysteresis: hysteresis, webhook: webhook}
+}
+
+// Update evaluates the rule against the latest records, which are in
+// percent, and returns whether the alert is active.
+func (a *DrawdownAlert) Update(records []DayRecord) bool {
+	if len(records) < 7 {
+		return false
+	}
+	last := records[len(records)-1]
+	delta := last.Full - records[len(records)-7].Full
+	threshold := -a.threshold
+	clearAt := threshold + a.hysteresis
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case !a.active && delta < threshold:
+		a.active = true
+		log.Printf("  🚨 Rapid drawdown: %.1f%% in 7 days (threshold %.1f%%)", delta, threshold)
+		if a.webhook != "" {
+			go postAlert(a.webhook, map[string]interface{}{
+				"alert":   "rapidDrawdown",
+				"delta7d": delta,
+				"fill":    last.Full,
+				"date":    last.Date.Format("2006-01-02"),
+			})
+		}
+	case a.active && delta > clearAt:
+		a.active = false
+		log.Printf("  ✅ Rapid drawdown cleared: %.1f%% in 7 days", delta)
+	}
+	return a.active
+}
+
+// postAlert sends an alert payload as JSON to a webhook.
+func postAlert(url string, payload map[string]interface{}) {
+	body, _ := json.Marshal(payload)
+	resp, err := alertClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("  ❌ Alert webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("  ❌ Alert webhook: HTTP %d", resp.StatusCode)
+	}
+}
 
-	cwsy := currentWinterStartYear()
+var alertClient = &http.Client{Timeout: 10 * time.Second}
 
-	var endDate string
-	if startYear == cwsy {
-		// Current season → end at today
-		endDate = now.Format("2006-01-02")
+// dataAge reports how old the given gas day is on c's calendar date
+// and whether that exceeds STALE_AFTER.
+func dataAge(c Config, gasDay time.Time) (hours float64, stale bool) {
+	age := c.Calendar.Now().Sub(gasDay)
+	return math.Round(age.Hours()*10) / 10, age > c.StaleAfter
+}
+
+// daysToEmpty estimates the days until storage reaches 0%. With the
+// absolute volume available it divides gas in storage (TWh) by the
+// 7-day net outflow (GWh/d); otherwise it extrapolates the linear
+// slope. Returns 999 while storage is being refilled.
+func daysToEmpty(last DayRecord, netOutflow float64, scenarios []Scenario) int {
+	if last.GasInStorage > 0 {
+		if netOutflow <= 0 {
+			return 999
+		}
+		return int(last.GasInStorage * 1000 / netOutflow)
+	}
+	for _, s := range scenarios {
+		if s.Name == "Linear" && s.Slope < 0 {
+			return int(last.Full / -s.Slope)
+		}
+	}
+	return 999
+}
+
+// daysToCritWithdrawal estimates the days until the critical level if
+// the 7-day average withdrawal (GWh/d) kept up, converted to the units
+// of last.Full: TWh/d, or percent of working gas volume per day.
+// Returns 999 without withdrawals or a known working gas volume.
+func daysToCritWithdrawal(last DayRecord, crit float64, absolute bool, avgWithdrawal float64) int {
+	if avgWithdrawal <= 0 || last.WorkingGasVolume <= 0 {
+		return 999
+	}
+	rate := avgWithdrawal / 1000
+	if !absolute {
+		rate = rate / last.WorkingGasVolume * 100
+	}
+	return max(int((last.Full-crit)/rate), 0)
+}
+
+// ─── Anomalies ──────────────────────────────────────────────
+
+// flagAnomalies marks records whose daily Trend drops more than sigma
+// standard deviations below the mean of the preceding window days,
+// and returns how many were flagged. Index 0 carries no real trend
+// and is never part of a window.
+func flagAnomalies(records []DayRecord, window int, sigma float64) int {
+	count := 0
+	for i := range records {
+		records[i].Anomaly = false
+		start := max(i-window, 1)
+		n := i - start
+		if n < minAnomalySamples {
+			continue
+		}
+		var sum, sq float64
+		for _, r := range records[start:i] {
+			sum += r.Trend
+		}
+		mean := sum / float64(n)
+		for _, r := range records[start:i] {
+			sq += (r.Trend - mean) * (r.Trend - mean)
+		}
+		sd := math.Sqrt(sq / float64(n))
+		if sd < 1e-9 {
+			continue
+		}
+		if z := (records[i].Trend - mean) / sd; z < -sigma {
+			records[i].Anomaly = true
+			count++
+		}
+	}
+	if count > 0 {
+		log.Printf("  🚨 %d anomalous withdrawal day(s) (> %.1fσ)", count, sigma)
+	}
+	return count
+}
+
+// ─── Season Comparison ──────────────────────────────────────
+
+// fillAtDay returns the fill level at the given DaysElapsed,
+// interpolating linearly between neighbouring records when the
+// exact day is missing. ok is false outside the season's range.
+func fillAtDay(records []DayRecord, day int) (fill float64, ok bool) {
+	r, _, ok := recordAtDay(records, day)
+	return r.Full, ok
+}
+
+// recordAtDay returns the record at the given DaysElapsed. A missing
+// day is interpolated linearly from its neighbours, fill and flows
+// alike, and reported as interpolated. ok is false outside the
+// season's range.
+func recordAtDay(records []DayRecord, day int) (rec DayRecord, interpolated, ok bool) {
+	i := sort.Search(len(records), func(i int) bool {
+		return records[i].DaysElapsed >= day
+	})
+	if i == len(records) {
+		return DayRecord{}, false, false
+	}
+	if records[i].DaysElapsed == day {
+		return records[i], false, true
+	}
+	if i == 0 {
+		return DayRecord{}, false, false
+	}
+	a, b := records[i-1], records[i]
+	frac := float64(day-a.DaysElapsed) / float64(b.DaysElapsed-a.DaysElapsed)
+	lerp := func(x, y float64) float64 { return x + (y-x)*frac }
+	date := a.Date.AddDate(0, 0, day-a.DaysElapsed)
+	return DayRecord{
+		Date:             date,
+		DateStr:          date.Format("02 Jan 2006"),
+		Full:             lerp(a.Full, b.Full),
+		Injection:        lerp(a.Injection, b.Injection),
+		Withdrawal:       lerp(a.Withdrawal, b.Withdrawal),
+		GasInStorage:     lerp(a.GasInStorage, b.GasInStorage),
+		WorkingGasVolume: lerp(a.WorkingGasVolume, b.WorkingGasVolume),
+		DaysElapsed:      day,
+	}, true, true
+}
+
+// SeasonAtDay is one season's values on the day asked for by /api/at.
+type SeasonAtDay struct {
+	Year         int     `json:"year"`
+	Name         string  `json:"name"`
+	Date         string  `json:"date"` // YYYY-MM-DD
+	Full         float64 `json:"full"`
+	Injection    float64 `json:"injection"`
+	Withdrawal   float64 `json:"withdrawal"`
+	Interpolated bool    `json:"interpolated"`
+}
+
+// seasonsAtDay slices every season at DaysElapsed day, skipping those
+// whose records don't reach it.
+func seasonsAtDay(seasons []SeasonData, day int) []SeasonAtDay {
+	out := []SeasonAtDay{}
+	for _, s := range seasons {
+		r, interpolated, ok := recordAtDay(s.Records, day)
+		if !ok {
+			continue
+		}
+		out = append(out, SeasonAtDay{
+			Year:         s.Config.Year,
+			Name:         s.Config.Name,
+			Date:         r.Date.Format("2006-01-02"),
+			Full:         r.Full,
+			Injection:    r.Injection,
+			Withdrawal:   r.Withdrawal,
+			Interpolated: interpolated,
+		})
+	}
+	return out
+}
+
+func buildSeasonDeltas(seasons []SeasonData, current []DayRecord) []SeasonDelta {
+	if len(current) == 0 {
+		return nil
+	}
+	last := current[len(current)-1]
+	var deltas []SeasonDelta
+	for _, s := range seasons {
+		if s.Config.IsCurrent {
+			continue
+		}
+		fill, ok := fillAtDay(s.Records, last.DaysElapsed)
+		if !ok {
+			continue
+		}
+		deltas = append(deltas, SeasonDelta{
+			Year:     s.Config.Year,
+			Name:     s.Config.Name,
+			DeltaPct: last.Full - fill,
+		})
+	}
+	return deltas
+}
+
+// CompareDay is one aligned day of /api/compare. A or B is nil when
+// that season has no record for the day; Delta is B minus A.
+type CompareDay struct {
+	DaysElapsed int      `json:"daysElapsed"`
+	A           *float64 `json:"a"`
+	B           *float64 `json:"b"`
+	Delta       *float64 `json:"delta"`
+}
+
+// SeasonStats are headline numbers for one season. Injection and
+// withdrawal totals are in GWh, summed over the season's gas days.
+type SeasonStats struct {
+	Records         int     `json:"records"`
+	MinFill         float64 `json:"minFill"`
+	MinFillDate     string  `json:"minFillDate"`
+	MaxWithdrawal   float64 `json:"maxWithdrawal"`
+	TotalInjection  float64 `json:"totalInjection"`
+	TotalWithdrawal float64 `json:"totalWithdrawal"`
+	EndFill         float64 `json:"endFill"`
+}
+
+func seasonStats(records []DayRecord) SeasonStats {
+	st := SeasonStats{Records: len(records)}
+	if len(records) == 0 {
+		return st
+	}
+	st.MinFill = records[0].Full
+	st.MinFillDate = records[0].Date.Format("2006-01-02")
+	for _, r := range records {
+		if r.Full < st.MinFill {
+			st.MinFill = r.Full
+			st.MinFillDate = r.Date.Format("2006-01-02")
+		}
+		st.MaxWithdrawal = math.Max(st.MaxWithdrawal, r.Withdrawal)
+		st.TotalInjection += r.Injection
+		st.TotalWithdrawal += r.Withdrawal
+	}
+	st.EndFill = records[len(records)-1].Full
+	return st
+}
+
+// SeasonSummary identifies a compared season alongside its stats.
+type SeasonSummary struct {
+	Year int    `json:"year"`
+	Name string `json:"name"`
+	SeasonStats
+}
+
+func summarizeSeason(cal Calendar, year int, records []DayRecord) SeasonSummary {
+	return SeasonSummary{
+		Year:        year,
+		Name:        cal.Name(year),
+		SeasonStats: seasonStats(records),
+	}
+}
+
+// alignSeasons merges two sorted seasons by DaysElapsed.
+func alignSeasons(a, b []DayRecord) []CompareDay {
+	days := make([]CompareDay, 0, max(len(a), len(b)))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var d CompareDay
+		switch {
+		case j == len(b) || (i < len(a) && a[i].DaysElapsed < b[j].DaysElapsed):
+			d.DaysElapsed, d.A = a[i].DaysElapsed, &a[i].Full
+			i++
+		case i == len(a) || b[j].DaysElapsed < a[i].DaysElapsed:
+			d.DaysElapsed, d.B = b[j].DaysElapsed, &b[j].Full
+			j++
+		default:
+			delta := b[j].Full - a[i].Full
+			d.DaysElapsed, d.A, d.B, d.Delta = a[i].DaysElapsed, &a[i].Full, &b[j].Full, &delta
+			i++
+			j++
+		}
+		days = append(days, d)
+	}
+	return days
+}
+
+// ─── Percentile Bands ───────────────────────────────────────
+
+// BandPoint is the spread of historical fill levels on one day of the
+// season, the "normal range" the current winter is plotted against.
+type BandPoint struct {
+	Day     int     `json:"day"`
+	Min     float64 `json:"min"`
+	P25     float64 `json:"p25"`
+	Median  float64 `json:"median"`
+	P75     float64 `json:"p75"`
+	Max     float64 `json:"max"`
+	Seasons int     `json:"seasons"` // how many winters have this day
+}
+
+// percentileBands aggregates the fill of every non-current season by
+// DaysElapsed. Seasons differ in length and may have gaps, so each
+// day uses whichever seasons cover it, and days covered by fewer than
+// minBandSeasons are left out.
+func percentileBands(seasons []SeasonData) []BandPoint {
+	byDay := make(map[int][]float64)
+	lastDay := -1
+	for _, s := range seasons {
+		if s.Config.IsCurrent {
+			continue
+		}
+		for _, r := range s.Records {
+			byDay[r.DaysElapsed] = append(byDay[r.DaysElapsed], r.Full)
+			lastDay = max(lastDay, r.DaysElapsed)
+		}
+	}
+	var out []BandPoint
+	for d := 0; d <= lastDay; d++ {
+		vals := byDay[d]
+		if len(vals) < minBandSeasons {
+			continue
+		}
+		slices.Sort(vals)
+		out = append(out, BandPoint{
+			Day:     d,
+			Min:     vals[0],
+			P25:     percentile(vals, 25),
+			Median:  percentile(vals, 50),
+			P75:     percentile(vals, 75),
+			Max:     vals[len(vals)-1],
+			Seasons: len(vals),
+		})
+	}
+	return out
+}
+
+// percentile returns the p-th percentile of sorted values, linearly
+// interpolating between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	pos := p / 100 * float64(len(sorted)-1)
+	lo := int(pos)
+	if lo >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	frac := pos - float64(lo)
+	return sorted[lo] + frac*(sorted[lo+1]-sorted[lo])
+}
+
+// ─── Baseline ───────────────────────────────────────────────
+
+// BaselineDay is the mean fill of the baseline seasons on one day of
+// the season, the "5-year average" of policy discussions.
+type BaselineDay struct {
+	Day     int     `json:"day"`
+	Mean    float64 `json:"mean"`
+	Seasons int     `json:"seasons"` // how many baseline seasons have this day
+}
+
+// baselineAverage averages the fill of the n most recent seasons
+// before cwsy by DaysElapsed. Seasons differ in length and may have
+// gaps, so each day averages only the seasons that cover it.
+func baselineAverage(seasons []SeasonData, cwsy, n int) []BaselineDay {
+	var past []SeasonData
+	for _, s := range seasons {
+		if s.Config.Year < cwsy && len(s.Records) > 0 {
+			past = append(past, s)
+		}
+	}
+	if n == 0 || len(past) == 0 {
+		return nil
+	}
+	if len(past) > n {
+		past = past[len(past)-n:]
+	} else if len(past) < n {
+		log.Printf("  ⚠️  Baseline over %d of %d seasons", len(past), n)
+	}
+
+	sum := make(map[int]float64)
+	count := make(map[int]int)
+	lastDay := -1
+	for _, s := range past {
+		for _, r := range s.Records {
+			sum[r.DaysElapsed] += r.Full
+			count[r.DaysElapsed]++
+			lastDay = max(lastDay, r.DaysElapsed)
+		}
+	}
+	var out []BaselineDay
+	for d := 0; d <= lastDay; d++ {
+		if c := count[d]; c > 0 {
+			out = append(out, BaselineDay{Day: d, Mean: sum[d] / float64(c), Seasons: c})
+		}
+	}
+	return out
+}
+
+// ─── Monthly Aggregates ─────────────────────────────────────
+
+// MonthBucket aggregates all loaded records of one calendar month.
+// Flows are totals in GWh.
+type MonthBucket struct {
+	Month           string  `json:"month"` // YYYY-MM
+	Days            int     `json:"days"`
+	MeanFill        float64 `json:"meanFill"`
+	TotalInjection  float64 `json:"totalInjection"`
+	TotalWithdrawal float64 `json:"totalWithdrawal"`
+}
+
+func monthlyBuckets(seasons map[int][]DayRecord) []MonthBucket {
+	byMonth := map[string]*MonthBucket{}
+	for _, records := range seasons {
+		for _, r := range records {
+			key := r.Date.Format("2006-01")
+			b, ok := byMonth[key]
+			if !ok {
+				b = &MonthBucket{Month: key}
+				byMonth[key] = b
+			}
+			b.Days++
+			b.MeanFill += r.Full
+			b.TotalInjection += r.Injection
+			b.TotalWithdrawal += r.Withdrawal
+		}
+	}
+	out := make([]MonthBucket, 0, len(byMonth))
+	for _, b := range byMonth {
+		b.MeanFill /= float64(b.Days)
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Month < out[j].Month })
+	return out
+}
+
+// monthlyMemo keeps the last buckets along with what they were
+// computed from, so they are only recomputed after a rebuild or when
+// more seasons have been cached.
+var monthlyMemo struct {
+	sync.Mutex
+	src     *DashboardData
+	seasons int
+	buckets []MonthBucket
+}
+
+// monthlyFor aggregates the dashboard's seasons plus any other
+// seasons in the season cache, e.g. warmed by /api/compare.
+func monthlyFor(data *DashboardData) []MonthBucket {
+	seasons := seasonCache.Seasons(Facility{})
+	for year, records := range data.seasonMap() {
+		seasons[year] = records
+	}
+
+	monthlyMemo.Lock()
+	defer monthlyMemo.Unlock()
+	if monthlyMemo.src != data || monthlyMemo.seasons != len(seasons) {
+		monthlyMemo.src, monthlyMemo.seasons = data, len(seasons)
+		monthlyMemo.buckets = monthlyBuckets(seasons)
+	}
+	return monthlyMemo.buckets
+}
+
+// ─── Downsampling ───────────────────────────────────────────
+
+// downsampleIndices picks every stride-th record, or, with maxPoints
+// set, a stride that brings the season down to about maxPoints. The
+// first and last records, the minimum and maximum fill and anomalies
+// are always kept, so the result can exceed maxPoints slightly. It
+// returns nil when no downsampling is needed.
+func downsampleIndices(records []DayRecord, stride, maxPoints int) []int {
+	if maxPoints > 0 {
+		stride = (len(records) + maxPoints - 1) / maxPoints
+	}
+	if stride <= 1 || len(records) <= 2 {
+		return nil
+	}
+	minIdx, maxIdx := 0, 0
+	for i, r := range records {
+		if r.Full < records[minIdx].Full {
+			minIdx = i
+		}
+		if r.Full > records[maxIdx].Full {
+			maxIdx = i
+		}
+	}
+	keep := make([]int, 0, len(records)/stride+4)
+	for i, r := range records {
+		if i%stride == 0 || i == len(records)-1 || i == minIdx || i == maxIdx || r.Anomaly {
+			keep = append(keep, i)
+		}
+	}
+	return keep
+}
+
+// downsampled returns a copy of d with every season's records, and
+// the smoothed series alongside them, downsampled; d itself, which is
+// shared with the cache, is untouched.
+func (d *DashboardData) downsampled(stride, maxPoints int) *DashboardData {
+	out := *d
+	out.Seasons = make([]SeasonData, len(d.Seasons))
+	for i, s := range d.Seasons {
+		if keep := downsampleIndices(s.Records, stride, maxPoints); keep != nil {
+			records := make([]DayRecord, len(keep))
+			for j, k := range keep {
+				records[j] = s.Records[k]
+			}
+			if s.Smoothed != nil {
+				smoothed := make([]float64, len(keep))
+				for j, k := range keep {
+					smoothed[j] = s.Smoothed[k]
+				}
+				s.Smoothed = smoothed
+			}
+			s.Records = records
+		}
+		out.Seasons[i] = s
+	}
+	return &out
+}
+
+// ─── Smoothing ──────────────────────────────────────────────
+
+// smoothFill returns a centered moving average of Full. Near the
+// ends the window shrinks to the records available on each side.
+func smoothFill(records []DayRecord, window int) []float64 {
+	half := window / 2
+	out := make([]float64, len(records))
+	for i := range records {
+		lo, hi := max(i-half, 0), min(i+half, len(records)-1)
+		sum := 0.0
+		for j := lo; j <= hi; j++ {
+			sum += records[j].Full
+		}
+		out[i] = sum / float64(hi-lo+1)
+	}
+	return out
+}
+
+// ─── Season Pivot ───────────────────────────────────────────
+
+// detectWinterStart reports whether the winters of cal are aligned on
+// their data-driven pivot instead of winterStartMD.
+func detectWinterStart(cal Calendar) bool {
+	return cal.DetectStart && !cal.Summer
+}
+
+// seasonPivot returns the DaysElapsed of the first day from which net
+// flow stays negative for run days in a row. Records only start at
+// winterStartMD, so the pivot can fall later but not earlier.
+func seasonPivot(records []DayRecord, run int) (int, bool) {
+	n := 0
+	for i, r := range records {
+		if r.NetFlow >= 0 {
+			n = 0
+			continue
+		}
+		if n++; n == run {
+			return records[i-run+1].DaysElapsed, true
+		}
+	}
+	return 0, false
+}
+
+// anchorAtPivot returns a copy of records re-based on the season pivot:
+// DaysElapsed counts from the pivot, earlier days are dropped and the
+// cumulative net flow restarts there. shift is the pivot's offset from
+// winterStartMD, 0 when none was found.
+func anchorAtPivot(records []DayRecord, run int) (out []DayRecord, shift int) {
+	pivot, ok := seasonPivot(records, run)
+	if !ok || pivot == 0 {
+		return records, 0
+	}
+	cum := 0.0
+	for _, r := range records {
+		if r.DaysElapsed < pivot {
+			continue
+		}
+		r.DaysElapsed -= pivot
+		cum += r.NetFlow
+		r.CumNetFlow = cum
+		out = append(out, r)
+	}
+	return out, pivot
+}
+
+// ─── Ticks ──────────────────────────────────────────────────
+
+// generateTicks labels the x axis from winter start to the target end
+// date, or to lastDay if the data runs past it, every step days.
+// The final day gets its own tick unless the regular tick before it
+// is within half a step, so the axis ends on the season boundary.
+// Labels are shifted by shift days when the axis starts at the current
+// season's pivot (see anchorAtPivot).
+func generateTicks(cal Calendar, startYear, lastDay, shift, step int) ([]int, []string) {
+	end := max(cal.Days(startYear)-1, lastDay)
+
+	var vals []int
+	var labels []string
+	startStr := cal.StartDate(startYear)
+	start, _ := time.ParseInLocation("2006-01-02", startStr, displayLoc)
+	start = start.AddDate(0, 0, shift)
+	add := func(d int) {
+		vals = append(vals, d)
+		labels = append(labels, start.AddDate(0, 0, d).Format("02 Jan"))
+	}
+	for d := 0; d <= end; d += step {
+		add(d)
+	}
+	if last := vals[len(vals)-1]; end-last > step/2 {
+		add(end)
+	}
+	return vals, labels
+}
+
+// ─── Season Configs ─────────────────────────────────────────
+
+// seasonStyle is the look of a plotted season.
+type seasonStyle struct {
+	Color     string
+	Width     int
+	Dash      string
+	FillColor string
+}
+
+// Palettes list history colors from the most recent prior season
+// backwards; they cycle when more seasons are shown. The current
+// season always uses the palette's emphasis color, which is kept out
+// of the history list so it stays distinct.
+type palette struct {
+	Current string
+	History []string
+}
+
+var palettes = map[string]palette{
+	"default": {
+		Current: "#2563eb",
+		History: []string{"#059669", "#7c3aed", "#7f8c8d", "#bdc3c7"},
+	},
+	// Okabe-Ito, with blue reserved for the current season.
+	"colorblind": {
+		Current: "#0072b2",
+		History: []string{"#e69f00", "#56b4e9", "#009e73", "#cc79a7", "#d55e00", "#f0e442"},
+	},
+}
+
+const (
+	historyFillAlpha = 0.08
+	currentFillAlpha = 0.18
+)
+
+var hexColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// parsePalette reads a SEASON_PALETTE value: a built-in name
+// ("default", "colorblind") or a comma-separated list of #rrggbb
+// colors, the first of which is used for the current season.
+func parsePalette(v string) (palette, error) {
+	if p, ok := palettes[strings.ToLower(v)]; ok {
+		return p, nil
+	}
+	var colors []string
+	for _, c := range splitList(v) {
+		if !hexColorPattern.MatchString(c) {
+			return palette{}, fmt.Errorf("invalid SEASON_PALETTE color %q", c)
+		}
+		colors = append(colors, strings.ToLower(c))
+	}
+	if len(colors) < 2 {
+		return palette{}, errors.New("SEASON_PALETTE needs a current and at least one history color")
+	}
+	return palette{Current: colors[0], History: colors[1:]}, nil
+}
+
+// historyStyle styles the season `back` winters before the current
+// one. The two most recent are drawn solid, older ones dotted.
+func (p palette) historyStyle(back int) seasonStyle {
+	color := p.History[(back-1)%len(p.History)]
+	st := seasonStyle{Color: color, Width: 3, Dash: "solid", FillColor: fillColor(color, historyFillAlpha)}
+	if back > 2 {
+		st.Width, st.Dash = 2, "dot"
+	}
+	return st
+}
+
+func (p palette) currentStyle() seasonStyle {
+	return seasonStyle{Color: p.Current, Width: 4, Dash: "solid", FillColor: fillColor(p.Current, currentFillAlpha)}
+}
+
+// fillColor turns a #rrggbb line color into an rgba() fill.
+func fillColor(hex string, alpha float64) string {
+	v, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	if err != nil {
+		return hex
+	}
+	return fmt.Sprintf("rgba(%d,%d,%d,%g)", v>>16&0xff, v>>8&0xff, v&0xff, alpha)
+}
+
+// buildSeasonConfigs returns the configs for the given number of
+// prior seasons plus the current one, oldest first. Seasons before
+// SEASON_YEAR_MIN are dropped.
+func buildSeasonConfigs(c Config, cwsy, history int) []SeasonConfig {
+	cal, pal := c.Calendar, c.Palette
+	lo, _ := cal.YearRange()
+	var configs []SeasonConfig
+	for back := history; back >= 1; back-- {
+		year := cwsy - back
+		if year < lo {
+			continue
+		}
+		st := pal.historyStyle(back)
+		configs = append(configs, SeasonConfig{
+			Year:  year,
+			Name:  cal.Name(year),
+			Color: st.Color, Width: st.Width, Dash: st.Dash,
+			FillColor: st.FillColor,
+		})
+	}
+	cur := pal.currentStyle()
+	return append(configs, SeasonConfig{
+		Year:  cwsy,
+		Name:  cal.Name(cwsy) + " (Current)",
+		Color: cur.Color, Width: cur.Width, Dash: cur.Dash,
+		FillColor: cur.FillColor,
+		IsCurrent: true,
+	})
+}
+
+// ─── Dashboard Builder ─────────────────────────────────────
+
+// buildDashboard builds the country aggregate, recording the outcome
+// in buildStatus and the KPI history. With -dump every successful
+// build is also written to c.DumpPath as indented JSON for debugging.
+func buildDashboard(c Config) (data *DashboardData, err error) {
+	defer func() { buildStatus.recordBuild(err) }()
+
+	data, err = buildDashboardFor(c, Facility{})
+	if err != nil {
+		return nil, err
+	}
+
+	history.Add(Snapshot{
+		Timestamp:   time.Now().In(displayLoc).Format(time.RFC3339),
+		CurrentFill: data.KPI.CurrentFill,
+		DaysToCrit:  data.KPI.DaysToCrit,
+	})
+	if c.DumpPath != "" {
+		if err := dumpDashboard(c.DumpPath, data); err != nil {
+			log.Printf("⚠️  Dump failed: %v", err)
+		}
+	}
+	return data, nil
+}
+
+// dumpDashboard writes data to path, via a temporary file so readers
+// never see a partial dump.
+func dumpDashboard(path string, data *DashboardData) error {
+	body, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(body, '\n'), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	log.Printf("  💾 Dashboard dumped to %s", path)
+	return nil
+}
+
+// buildDashboardFor builds the dashboard for the country aggregate or,
+// when fac is set, a single storage facility.
+func buildDashboardFor(c Config, fac Facility) (*DashboardData, error) {
+	log.Println("\n════════════════════════════════════════")
+	if fac.IsZero() {
+		log.Println("  📡 Building Dashboard")
 	} else {
-		// Past season → end at March 31 of the following year
-		endDate = fmt.Sprintf("%d-%s", startYear+1, targetEndMD)
+		log.Printf("  📡 Building Dashboard for facility %s", fac.EIC)
 	}
+	log.Println("════════════════════════════════════════")
 
-	// Sanity: don't fetch if start is in the future
-	seasonStartParsed, _ := time.Parse("2006-01-02", startDate)
-	if seasonStartParsed.After(now) {
-		return nil, fmt.Errorf("season %d starts in the future (%s)", startYear, startDate)
+	now := time.Now().In(displayLoc)
+	cwsy := c.Calendar.CurrentStartYear()
+
+	if c.Calendar.Pinned() {
+		log.Printf("  📌 As of: %s (AS_OF)", c.Calendar.AsOf.Format("02 Jan 2006"))
+	} else {
+		log.Printf("  📅 Today: %s", now.Format("02 Jan 2006"))
+	}
+	log.Printf("  📅 Current season start year: %d (%s)", cwsy, c.Calendar.Name(cwsy))
+
+	// The baseline may reach back further than the plotted seasons; the
+	// extra ones are loaded but dropped once it is computed.
+	shown := c.HistorySeasons
+	configs := buildSeasonConfigs(c, cwsy, max(shown, c.BaselineSeasons))
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.BuildTimeout)
+	defer cancel()
+	allSeasons, seasons, warnings, fetchErr := fetchAllSeasons(ctx, c, configs, fac)
+
+	// A build cut short before the current season loaded would present
+	// an old winter as current; fail it instead.
+	if _, ok := allSeasons[cwsy]; !ok && errors.Is(fetchErr, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("build timed out before the current season loaded: %w", fetchErr)
+	}
+
+	if len(seasons) == 0 {
+		if fetchErr == nil {
+			fetchErr = ErrEmptyData
+		}
+		return nil, fmt.Errorf("no season data loaded from API: %w", fetchErr)
+	}
+
+	// With WINTER_START=detect every season is re-based on its own
+	// pivot so the overlay lines up on the start of withdrawal.
+	currentShift := 0
+	if detectWinterStart(c.Calendar) {
+		for i := range seasons {
+			year := seasons[i].Config.Year
+			records, shift := anchorAtPivot(seasons[i].Records, c.Calendar.PivotRunDays)
+			if len(records) == 0 {
+				continue
+			}
+			seasons[i].Records = records
+			allSeasons[year] = records
+			if shift > 0 {
+				seasons[i].AnchorDate = records[0].Date.Format("2006-01-02")
+				log.Printf("  🔀 %s: pivot %s (+%d days)", seasons[i].Config.Name, seasons[i].AnchorDate, shift)
+			}
+			if year == cwsy {
+				currentShift = shift
+			}
+		}
 	}
 
-	url := fmt.Sprintf("%s?country=%s&from=%s&to=%s&size=%d",
-		apiURL, country, startDate, endDate, fetchSize)
+	baseline := baselineAverage(seasons, cwsy, c.BaselineSeasons)
+	seasons = slices.DeleteFunc(seasons, func(s SeasonData) bool {
+		return s.Config.Year < cwsy-shown
+	})
 
-	log.Printf("  📡 Fetching %d/%02d: %s → %s",
-		startYear, (startYear+1)%100, startDate, endDate)
+	// Find the current season records
+	var currentRecords []DayRecord
+	var currentFound bool
 
-	client := &http.Client{Timeout: fetchTimeout}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("request creation: %w", err)
+	if r, ok := allSeasons[cwsy]; ok && len(r) > 0 {
+		currentRecords = r
+		currentFound = true
+		log.Printf("\n  ✅ Current season %d: %d records", cwsy, len(r))
 	}
 
-	req.Header.Set("User-Agent",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 "+
-			"(KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
-	req.Header.Set("Referer", "https://agsi.gie.eu/")
-	req.Header.Set("Origin", "https://agsi.gie.eu")
+	if !currentFound {
+		// Fallback: use the most recent season with data
+		for i := len(seasons) - 1; i >= 0; i-- {
+			if len(seasons[i].Records) > 0 {
+				currentRecords = seasons[i].Records
+				// Mark it as current
+				seasons[i].Config.IsCurrent = true
+				log.Printf("\n  ⚠️  Fallback: using %s as current (%d records)",
+					seasons[i].Config.Name, len(currentRecords))
+				currentFound = true
+				break
+			}
+		}
+	}
 
-	if apiKey := os.Getenv("AGSI_API_KEY"); apiKey != "" {
-		req.Header.Set("x-key", apiKey)
+	if !currentFound {
+		return nil, fmt.Errorf("no usable current season data")
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("HTTP request: %w", err)
+	// AGSI may still revise the latest days. The last PROVISIONAL_DAYS
+	// stay on the chart, flagged, but are left out of the trend,
+	// scenarios and KPIs.
+	var provisional []string
+	if n := c.ProvisionalDays; n > 0 {
+		for i := range seasons {
+			if !seasons[i].Config.IsCurrent {
+				continue
+			}
+			records := slices.Clone(seasons[i].Records)
+			keep := max(len(records)-n, 1)
+			for j := keep; j < len(records); j++ {
+				records[j].Provisional = true
+				provisional = append(provisional, records[j].Date.Format("2006-01-02"))
+			}
+			seasons[i].Records = records
+			currentRecords = records[:keep]
+			log.Printf("  ⏸️  %d provisional day(s) excluded from analysis", len(provisional))
+		}
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("reading response: %w", err)
+	// Debug: verify trend data exists
+	nonZeroTrend := 0
+	for _, r := range currentRecords {
+		if r.Trend != 0 {
+			nonZeroTrend++
+		}
 	}
+	log.Printf("  📊 Current season: %d records, %d with non-zero trend",
+		len(currentRecords), nonZeroTrend)
 
-	log.Printf("     HTTP %d, %d bytes", resp.StatusCode, len(body))
+	smooth := c.SmoothWindow
+	for i := range seasons {
+		seasons[i].Stats = seasonStats(seasons[i].Records)
+		if smooth > 0 && seasons[i].Config.IsCurrent {
+			seasons[i].Smoothed = smoothFill(seasons[i].Records, smooth)
+		}
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		preview := string(body)
-		if len(preview) > 500 {
-			preview = preview[:500]
+	anomalies := flagAnomalies(currentRecords, trendWindow, c.AnomalySigma)
+	scenarios, scenarioNote := generateScenarios(c, currentRecords, allSeasons, cwsy, trendWindow)
+	kpi := buildKPI(c, currentRecords, scenarios)
+	kpi.Anomalies = anomalies
+	// The withdrawal-rate estimate stops at the season end like the
+	// scenarios do.
+	toEnd := c.Calendar.Days(cwsy) - 1 - currentRecords[len(currentRecords)-1].DaysElapsed
+	if c.SeasonHorizon && !c.Calendar.Summer && toEnd > 0 && kpi.DaysToCritWithdrawal > toEnd {
+		kpi.DaysToCritWithdrawal = 999
+	}
+	if fac.IsZero() {
+		kpi.RapidDrawdown = drawdownAlert.Update(currentRecords)
+	}
+	deltas := buildSeasonDeltas(seasons, currentRecords)
+	lastDay := 0
+	for _, sd := range seasons {
+		if n := len(sd.Records); n > 0 {
+			lastDay = max(lastDay, sd.Records[n-1].DaysElapsed)
 		}
-		return nil, fmt.Errorf("API status %d: %s", resp.StatusCode, preview)
+	}
+	tv, tl := generateTicks(c.Calendar, cwsy, lastDay, currentShift, c.TickStep)
+	_, _, absolute := toUnits(currentRecords, c.Units, c.Critical)
+	units := unitsPercent
+	if absolute {
+		units = unitsTWh
+	} else if c.Units == unitsTWh {
+		log.Printf("  ⚠️  UNITS=twh but absolute volumes are missing, using percent")
 	}
 
-	var apiResp APIResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return nil, fmt.Errorf("JSON decode: %w", err)
+	log.Printf("\n  ✅ Dashboard built:")
+	log.Printf("     Seasons   : %d", len(seasons))
+	log.Printf("     Scenarios : %d", len(scenarios))
+	log.Printf("     Fill      : %.1f%% as of %s", kpi.CurrentFill, kpi.CurrentDate)
+	log.Printf("     7d Δ      : %.2f%%", kpi.Delta7D)
+	log.Printf("     Avg withdrawal: %.0f GWh/d", kpi.AvgWithdrawal)
+	if kpi.DaysToCrit < 999 {
+		log.Printf("     Days to critical: ~%d", kpi.DaysToCrit)
+	} else if kpi.SurvivesSeason {
+		log.Println("     Days to critical: survives the season")
+	}
+	for _, d := range deltas {
+		log.Printf("     vs %s: %+.1f%%", d.Name, d.DeltaPct)
 	}
 
-	if len(apiResp.Data) == 0 {
-		log.Printf("     ⚠️  Empty data array for %d", startYear)
-		return nil, nil
+	var facility string
+	if !fac.IsZero() {
+		facility = fac.EIC
+		if last := currentRecords[len(currentRecords)-1]; last.Facility != "" {
+			facility = last.Facility
+		}
 	}
 
-	log.Printf("  ✅ %d: %d raw records", startYear, len(apiResp.Data))
+	var pinned string
+	if c.Calendar.Pinned() {
+		pinned = c.Calendar.AsOf.Format("2006-01-02")
+	}
+	mode, target := "winter", 0.0
+	if c.Calendar.Summer {
+		mode, target = "summer", c.RefillTarget
+	}
 
-	// Parse records
-	seasonStart, _ := time.Parse("2006-01-02", startDate)
-	records := make([]DayRecord, 0, len(apiResp.Data))
+	return &DashboardData{
+		Seasons:      seasons,
+		Scenarios:    scenarios,
+		KPI:          kpi,
+		SeasonDeltas: deltas,
+		TickVals:     tv,
+		TickLabels:   tl,
+		GeneratedAt:  now.Format("02 Jan 2006 15:04"),
+		CurrentYear:  cwsy,
+		Units:        units,
+		SeasonDays:   c.Calendar.Days(cwsy),
+		Critical:     c.Critical,
+		ScenarioNote: scenarioNote,
+		Bands:        percentileBands(seasons),
+		Baseline:     baseline,
+		Provisional:  provisional,
+		AsOf:         pinned,
+		SeasonMode:   mode,
+		RefillTarget: target,
+		Warnings:     warnings,
+		Facility:     facility,
+	}, nil
+}
 
-	for _, r := range apiResp.Data {
-		date := parseDate(r.GasDayStart)
-		if date.IsZero() {
-			log.Printf("     ⚠️  Skipping unparseable date: %q", r.GasDayStart)
-			continue
-		}
+// ─── Chart SVG ──────────────────────────────────────────────
 
-		elapsed := int(date.Sub(seasonStart).Hours() / 24)
+// svgDashArray maps Plotly dash styles to SVG stroke-dasharray values.
+var svgDashArray = map[string]string{
+	"dot":      "2,4",
+	"dash":     "8,5",
+	"dashdot":  "8,4,2,4",
+	"longdash": "14,6",
+}
 
-		records = append(records, DayRecord{
-			Date:        date,
-			DateStr:     date.Format("02 Jan 2006"),
-			Full:        parseFloat(r.Full),
-			Injection:   parseFloat(r.Injection),
-			Withdrawal:  parseFloat(r.Withdrawal),
-			DaysElapsed: elapsed,
-		})
-	}
+// renderChartSVG draws the season overlay and projections of data as
+// a standalone SVG of the given size, for reports and link previews.
+// The y axis is fill in percent; projections are only drawn when
+// UNITS is percent as well.
+func renderChartSVG(data *DashboardData, width, height int) []byte {
+	const left, right, top, bottom = 50.0, 170.0, 40.0, 40.0
+	plotW := float64(width) - left - right
+	plotH := float64(height) - top - bottom
+	xMax := float64(max(data.SeasonDays, 1) - 1)
+	px := func(x float64) float64 { return left + x/xMax*plotW }
+	py := func(y float64) float64 { return top + (1-y/100)*plotH }
 
-	if len(records) == 0 {
-		return nil, fmt.Errorf("no valid records parsed")
+	title := "German Gas Storage Monitor"
+	if data.Facility != "" {
+		title += " — " + data.Facility
 	}
 
-	// Sort ascending
-	sort.Slice(records, func(i, j int) bool {
-		return records[i].Date.Before(records[j].Date)
-	})
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#ffffff"/>`+"\n", width, height)
+	fmt.Fprintf(&b, `<text x="%g" y="22" font-size="15" font-weight="bold">%s</text>`+"\n",
+		left, template.HTMLEscapeString(title))
 
-	// Calculate trend + 7d MA
-	for i := range records {
-		if i > 0 {
-			records[i].Trend = records[i].Full - records[i-1].Full
+	// Critical zone and grid
+	fmt.Fprintf(&b, `<rect x="%g" y="%.1f" width="%g" height="%.1f" fill="rgba(231,64,64,0.06)" stroke="rgba(231,76,60,0.35)" stroke-dasharray="8,5"/>`+"\n",
+		left, py(data.Critical), plotW, py(0)-py(data.Critical))
+	for y := 0; y <= 100; y += 20 {
+		fmt.Fprintf(&b, `<line x1="%g" y1="%.1f" x2="%g" y2="%.1f" stroke="#e5e5e5"/>`+"\n",
+			left, py(float64(y)), left+plotW, py(float64(y)))
+		fmt.Fprintf(&b, `<text x="%g" y="%.1f" text-anchor="end">%d%%</text>`+"\n",
+			left-6, py(float64(y))+4, y)
+	}
+	every := max(len(data.TickVals)/10, 1)
+	for i, v := range data.TickVals {
+		if i%every != 0 || float64(v) > xMax {
+			continue
 		}
-		start := i - 6
-		if start < 0 {
-			start = 0
+		fmt.Fprintf(&b, `<text x="%.1f" y="%g" text-anchor="middle">%s</text>`+"\n",
+			px(float64(v)), top+plotH+16, template.HTMLEscapeString(data.TickLabels[i]))
+	}
+
+	line := func(pts []string, color string, width int, dash string) {
+		if len(pts) < 2 {
+			return
 		}
-		sum := 0.0
-		for j := start; j <= i; j++ {
-			sum += records[j].Trend
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="%d" stroke-linejoin="round"`, color, max(width, 1))
+		if d, ok := svgDashArray[dash]; ok {
+			fmt.Fprintf(&b, ` stroke-dasharray="%s"`, d)
 		}
-		records[i].TrendMA7 = sum / float64(i-start+1)
+		fmt.Fprintf(&b, ` points="%s"/>`+"\n", strings.Join(pts, " "))
 	}
+	type legendEntry struct{ label, color, dash string }
+	var legend []legendEntry
 
-	// Debug: print first and last record
-	log.Printf("     Range: %s (day %d, %.1f%%) → %s (day %d, %.1f%%)",
-		records[0].DateStr, records[0].DaysElapsed, records[0].Full,
-		records[len(records)-1].DateStr,
-		records[len(records)-1].DaysElapsed,
-		records[len(records)-1].Full)
+	// Seasons are stored oldest first, so the current one is drawn on top.
+	for _, s := range data.Seasons {
+		pts := make([]string, 0, len(s.Records))
+		for _, r := range s.Records {
+			pts = append(pts, fmt.Sprintf("%.1f,%.1f", px(float64(r.DaysElapsed)), py(r.Full)))
+		}
+		line(pts, s.Config.Color, s.Config.Width, s.Config.Dash)
+		legend = append(legend, legendEntry{s.Config.Name, s.Config.Color, s.Config.Dash})
+	}
 
-	// Debug: show sample trend values
-	if len(records) > 3 {
-		last := records[len(records)-1]
-		prev := records[len(records)-2]
-		log.Printf("     Last trend: %.3f%% (%.1f%% → %.1f%%), MA7: %.3f%%",
-			last.Trend, prev.Full, last.Full, last.TrendMA7)
+	if last, ok := data.lastRecord(); ok {
+		// Scenarios in TWh are drawn in percent like the seasons.
+		scale := 1.0
+		if data.Units == unitsTWh && last.WorkingGasVolume > 0 {
+			scale = 100 / last.WorkingGasVolume
+		}
+		for _, sc := range data.Scenarios {
+			pts := []string{fmt.Sprintf("%.1f,%.1f", px(float64(last.DaysElapsed)), py(last.Full))}
+			for _, p := range sc.Points {
+				if p.X > xMax {
+					break
+				}
+				pts = append(pts, fmt.Sprintf("%.1f,%.1f", px(p.X), py(max(p.Y*scale, 0))))
+			}
+			line(pts, sc.Color, 2, sc.Dash)
+			legend = append(legend, legendEntry{sc.Label, sc.Color, sc.Dash})
+		}
+	}
+
+	for i, e := range legend {
+		y := top + 8 + float64(i)*16
+		x := left + plotW + 14
+		fmt.Fprintf(&b, `<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="%s" stroke-width="2"`, x, y, x+22, y, e.color)
+		if d, ok := svgDashArray[e.dash]; ok {
+			fmt.Fprintf(&b, ` stroke-dasharray="%s"`, d)
+		}
+		fmt.Fprintf(&b, `/>`+"\n"+`<text x="%g" y="%g">%s</text>`+"\n", x+28, y+4, template.HTMLEscapeString(e.label))
 	}
 
-	return records, nil
+	fmt.Fprintf(&b, `<text x="%g" y="%d" fill="#888" font-size="10">Source: AGSI+ (GIE) · generated %s</text>`+"\n",
+		left, height-8, template.HTMLEscapeString(data.GeneratedAt))
+	b.WriteString("</svg>\n")
+	return []byte(b.String())
 }
 
-func parseDate(s string) time.Time {
-	// Try common formats
-	formats := []string{
-		"2006-01-02",
-		"2006-01-02T15:04:05Z",
-		"2006-01-02T15:04:05",
-		"2006-01-02 15:04:05",
-		time.RFC3339,
+// ─── Rate Limiting ──────────────────────────────────────────
+
+// TokenBucket is a minimal token-bucket rate limiter.
+type TokenBucket struct {
+	mu       sync.Mutex
+	tokens   float64
+	capacity float64
+	interval time.Duration // time to regain one token
+	last     time.Time
+}
+
+func newTokenBucket(capacity int, interval time.Duration) *TokenBucket {
+	return &TokenBucket{
+		tokens:   float64(capacity),
+		capacity: float64(capacity),
+		interval: interval,
+		last:     time.Now(),
 	}
-	for _, f := range formats {
-		if t, err := time.Parse(f, s); err == nil {
-			return t
-		}
+}
+
+// Allow takes a token if one is available. Otherwise it reports how
+// long until the next token is due.
+func (b *TokenBucket) Allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = math.Min(b.capacity, b.tokens+float64(now.Sub(b.last))/float64(b.interval))
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
 	}
-	return time.Time{}
+	return false, time.Duration((1 - b.tokens) * float64(b.interval))
 }
 
-func parseFloat(s string) float64 {
-	if s == "" || s == "-" || s == "N/A" {
-		return 0
+// ─── HTTP Handlers ──────────────────────────────────────────
+
+//go:embed static/favicon.ico
+var favicon []byte
+
+// handleFavicon serves the embedded icon so browsers stop requesting
+// /favicon.ico into a 404.
+func handleFavicon(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "image/x-icon")
+	w.Header().Set("Cache-Control", "public, max-age=604800")
+	w.Write(favicon)
+}
+
+// dashboardHandler serves the page, with base as the prefix for its
+// API calls.
+func dashboardHandler(base string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		tmpl, err := template.ParseFiles("templates/dashboard.html")
+		if err != nil {
+			http.Error(w, "Template error: "+err.Error(), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		tmpl.Execute(w, struct{ BasePath string }{base})
 	}
-	v, _ := strconv.ParseFloat(s, 64)
-	return v
 }
 
-// ─── Sequential Fetch ───────────────────────────────────────
+// apiHandler serves /api/data, building with c when the cache is
+// empty or bypassed.
+func apiHandler(c Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Add("Vary", "Accept")
 
-func fetchAllSeasons(configs []SeasonConfig) (map[int][]DayRecord, []SeasonData) {
-	allSeasons := make(map[int][]DayRecord)
-	var seasons []SeasonData
+		format, ok := negotiate(r.Header.Get("Accept"), mimeJSON, mimeCSV)
+		if !ok {
+			writeJSONError(w, http.StatusNotAcceptable, fmt.Sprintf(
+				"cannot serve Accept %q, use %s or %s", r.Header.Get("Accept"), mimeJSON, mimeCSV))
+			return
+		}
 
-	for i, cfg := range configs {
-		log.Printf("\n── Season %d/%d: %s ──", i+1, len(configs), cfg.Name)
+		fac, err := facilityFromQuery(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		stride, maxPoints, err := downsampleFromQuery(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 
-		records, err := fetchSeasonWithRetry(cfg.Year)
+		var data *DashboardData
+		src := cache
+		switch {
+		case bypassCache(r, c.BypassSecret):
+			log.Println("🔍 Cache bypass requested, building a one-off dashboard")
+			data, err = buildDashboardFor(c, fac)
+			src = nil
+		case fac.IsZero():
+			data, err = getDashboard(c)
+		default:
+			data, err = getFacilityDashboard(c, fac)
+			src = facilityCaches.get(fac)
+		}
 		if err != nil {
-			log.Printf("  ❌ %s: %v (skipping)", cfg.Name, err)
-		} else if len(records) == 0 {
-			log.Printf("  ⚠️  %s: no data (skipping)", cfg.Name)
+			writeBuildError(w, err)
+			return
+		}
+		if src != nil {
+			setCacheControl(w, src)
 		} else {
-			log.Printf("  ✅ %s: %d records loaded", cfg.Name, len(records))
-			allSeasons[cfg.Year] = records
-			seasons = append(seasons, SeasonData{Config: cfg, Records: records})
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		setStaleHeader(w, data)
+		if stride > 1 || maxPoints > 0 {
+			data = data.downsampled(stride, maxPoints)
+		}
+		if format == mimeCSV {
+			w.Header().Set("Content-Type", mimeCSV+"; charset=utf-8")
+			if err := writeRecordsCSV(w, data.currentRecords()); err != nil {
+				log.Printf("⚠️  Writing CSV: %v", err)
+			}
+			return
 		}
+		json.NewEncoder(w).Encode(data)
+	}
+}
+
+// ─── Content Negotiation ────────────────────────────────────
 
-		if i < len(configs)-1 {
-			time.Sleep(delayBetweenCalls)
+const (
+	mimeJSON = "application/json"
+	mimeCSV  = "text/csv"
+)
+
+// negotiate picks the offer the Accept header ranks highest, the
+// first offer on a tie or when the header is empty. It reports false
+// when the client accepts none of them.
+func negotiate(accept string, offers ...string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q := acceptQuality(accept, offer)
+		if q > bestQ {
+			best, bestQ = offer, q
 		}
 	}
+	return best, bestQ > 0
+}
 
-	return allSeasons, seasons
+// acceptQuality returns the q value Accept gives to mime, using the
+// most specific matching range: type/subtype, then type/*, then */*.
+func acceptQuality(accept, mime string) float64 {
+	typ, _, _ := strings.Cut(mime, "/")
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		rng := strings.ToLower(strings.TrimSpace(params[0]))
+		var spec int
+		switch rng {
+		case mime:
+			spec = 2
+		case typ + "/*":
+			spec = 1
+		case "*/*":
+			spec = 0
+		default:
+			continue
+		}
+		if spec < specificity {
+			continue
+		}
+		pq := 1.0
+		for _, p := range params[1:] {
+			if k, v, ok := strings.Cut(strings.TrimSpace(p), "="); ok && strings.TrimSpace(k) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					pq = f
+				}
+			}
+		}
+		q, specificity = pq, spec
+	}
+	return q
 }
 
-// ─── Scenarios ──────────────────────────────────────────────
+// writeRecordsCSV writes records as CSV, one row per gas day.
+func writeRecordsCSV(w io.Writer, records []DayRecord) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"date", "full", "injection", "withdrawal", "netFlow", "gasInStorage",
+		"workingGasVolume", "daysElapsed", "trend", "trendMa7", "trendEwma",
+		"interpolated", "provisional",
+	})
+	num := func(v float64) string { return strconv.FormatFloat(math.Round(v*1e4)/1e4, 'f', -1, 64) }
+	for _, rec := range records {
+		cw.Write([]string{
+			rec.Date.Format("2006-01-02"), num(rec.Full), num(rec.Injection),
+			num(rec.Withdrawal), num(rec.NetFlow), num(rec.GasInStorage),
+			num(rec.WorkingGasVolume), strconv.Itoa(rec.DaysElapsed),
+			num(rec.Trend), num(rec.TrendMA7), num(rec.TrendEWMA),
+			strconv.FormatBool(rec.Interpolated), strconv.FormatBool(rec.Provisional),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
 
-func generateScenarios(current []DayRecord, allSeasons map[int][]DayRecord,
-	currentStartYear int) []Scenario {
+// bypassCache reports whether the request carries X-Bypass-Cache with
+// the BYPASS_CACHE_SECRET, asking for a fresh build that is served to
+// this request only and never stored. Without the secret configured
+// the header is ignored.
+func bypassCache(r *http.Request, secret string) bool {
+	got := r.Header.Get("X-Bypass-Cache")
+	return secret != "" && got != "" &&
+		subtle.ConstantTimeCompare([]byte(got), []byte(secret)) == 1
+}
 
-	if len(current) < trendWindow {
-		log.Printf("  ⚠️  Not enough data for scenarios (%d < %d)",
-			len(current), trendWindow)
-		return nil
+// downsampleFromQuery reads ?resolution=daily|weekly or ?maxpoints=N.
+// A stride of 1 and maxPoints of 0 mean full resolution.
+func downsampleFromQuery(r *http.Request) (stride, maxPoints int, err error) {
+	q := r.URL.Query()
+	res, mp := q.Get("resolution"), q.Get("maxpoints")
+	if res != "" && mp != "" {
+		return 0, 0, fmt.Errorf("use either resolution or maxpoints, not both")
 	}
+	switch res {
+	case "", "daily":
+		stride = 1
+	case "weekly":
+		stride = 7
+	default:
+		return 0, 0, fmt.Errorf("resolution must be daily or weekly")
+	}
+	if mp != "" {
+		n, err := strconv.Atoi(mp)
+		if err != nil || n < minDownsamplePoints {
+			return 0, 0, fmt.Errorf("maxpoints must be an integer of at least %d", minDownsamplePoints)
+		}
+		maxPoints = n
+	}
+	return stride, maxPoints, nil
+}
 
-	lastIdx := len(current) - 1
-	currentVal := current[lastIdx].Full
-	currentDay := current[lastIdx].DaysElapsed
-	lastDate := current[lastIdx].Date
-
-	var scenarios []Scenario
+// getDashboard returns the cached dashboard, building it when the
+// cache is empty or expired. Concurrent callers share one build.
+func getDashboard(c Config) (*DashboardData, error) {
+	if cached := cache.Get(); cached != nil {
+		log.Println("📦 Serving cached data")
+		cache.hits.Add(1)
+		return cached, nil
+	}
 
-	recentStart := max(len(current)-trendWindow, 0)
-	slope, _ := linearRegression(current[recentStart:])
-	log.Printf("  📈 Slope: %.4f%%/day over %d days", slope, len(current[recentStart:]))
+	data, err, shared := cache.builds.Do(func() (*DashboardData, error) {
+		// A build finished between our Get and Do.
+		if cached := cache.Get(); cached != nil {
+			return cached, nil
+		}
+		if wait := buildStatus.backoffRemaining(); wait > 0 {
+			return nil, fmt.Errorf("%w, next attempt in %v", ErrBackingOff,
+				wait.Round(time.Second))
+		}
+		data, err := buildDashboard(c)
+		if err != nil {
+			return nil, err
+		}
+		cache.Set(data)
+		return data, nil
+	})
+	// Whoever waited on someone else's successful build found it built.
+	if shared && err == nil {
+		cache.hits.Add(1)
+	} else {
+		cache.misses.Add(1)
+	}
+	if err != nil {
+		return staleFallback(err)
+	}
+	return data, nil
+}
 
-	if slope < 0 {
-		days := (criticalThreshold - currentVal) / slope
-		hitDate := lastDate.Add(time.Duration(days*24) * time.Hour)
-		scenarios = append(scenarios, Scenario{
-			Name: "Linear", Label: "📉 Linear Trend",
-			Color: "#c0392b", Dash: "dot",
-			Points:   makeProjectionPoints(currentDay, currentVal, slope, days, lastDate, 50),
-			HitDate:  hitDate.Format("02.01.2006"),
-			Slope:    slope,
-			DaysLeft: int(days),
-		})
-		log.Printf("  📉 Linear: ~%d days → %s", int(days), hitDate.Format("02 Jan 2006"))
+// staleFallback returns a copy of the last good build marked with the
+// reason it is stale, or err if there has never been a good build.
+func staleFallback(err error) (*DashboardData, error) {
+	last := cache.Latest()
+	if last == nil {
+		return nil, err
+	}
+	log.Printf("⚠️  Serving last good data from %s: %v", last.GeneratedAt, err)
+	d := *last
+	d.StaleReason = err.Error()
+	return &d, nil
+}
 
-		ss := slope * stressMultiplier
-		sd := (criticalThreshold - currentVal) / ss
-		shd := lastDate.Add(time.Duration(sd*24) * time.Hour)
-		scenarios = append(scenarios, Scenario{
-			Name: "Stress", Label: "❄️ Severe Winter",
-			Color: "#800000", Dash: "dashdot",
-			Points:   makeProjectionPoints(currentDay, currentVal, ss, sd, lastDate, 50),
-			HitDate:  shd.Format("02.01.2006"),
-			Slope:    ss,
-			DaysLeft: int(sd),
-		})
-		log.Printf("  ❄️  Stress: ~%d days → %s", int(sd), shd.Format("02 Jan 2006"))
+// getFacilityDashboard is getDashboard for a single facility. Facility
+// builds have their own cache and do not count towards the aggregate's
+// build status or backoff.
+func getFacilityDashboard(cfg Config, fac Facility) (*DashboardData, error) {
+	c := facilityCaches.get(fac)
+	if cached := c.Get(); cached != nil {
+		log.Printf("📦 Serving cached data for facility %s", fac.EIC)
+		return cached, nil
 	}
 
-	// Historical — use the season before current
-	histYear := currentStartYear - 1
-	if recs, ok := allSeasons[histYear]; ok && len(recs) > 0 {
-		var pts []ScenarioPoint
-		var base float64
-		found := false
-		for _, r := range recs {
-			if r.DaysElapsed > currentDay {
-				if !found {
-					base = r.Full
-					found = true
-				}
-				pts = append(pts, ScenarioPoint{
-					X:         float64(r.DaysElapsed),
-					Y:         currentVal + (r.Full - base),
-					HoverDate: r.Date.Format("02 Jan"),
-				})
-			}
+	data, err, _ := c.builds.Do(func() (*DashboardData, error) {
+		if cached := c.Get(); cached != nil {
+			return cached, nil
 		}
-		if len(pts) > 0 {
-			scenarios = append(scenarios, Scenario{
-				Name:  "History",
-				Label: fmt.Sprintf("📅 Like %d/%02d", histYear, (histYear+1)%100),
-				Color: "#d35400", Dash: "dash",
-				Points: pts,
-			})
-			log.Printf("  📅 History: %d points from %d/%02d",
-				len(pts), histYear, (histYear+1)%100)
+		data, err := buildDashboardFor(cfg, fac)
+		if err != nil {
+			return nil, err
+		}
+		c.Set(data)
+		return data, nil
+	})
+	return data, err
+}
+
+// setCacheControl lets downstream caches keep a response only as long
+// as our own cache considers it fresh.
+func setCacheControl(w http.ResponseWriter, c *Cache) {
+	if secs := int(c.Remaining().Seconds()); secs > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", secs))
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+}
+
+// setStaleHeader flags responses served from the last good build.
+func setStaleHeader(w http.ResponseWriter, data *DashboardData) {
+	if data.StaleReason != "" {
+		w.Header().Set("X-Dashboard-Stale", "1")
+	}
+}
+
+func writeBuildError(w http.ResponseWriter, err error) {
+	status, hint := buildErrorStatus(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   err.Error(),
+		"message": "Failed to build dashboard.",
+		"hint":    hint,
+	})
+}
+
+// apiV2Handler serves the dashboard in the library-agnostic v2 schema.
+func apiV2Handler(c Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		data, err := getDashboard(c)
+		if err != nil {
+			writeBuildError(w, err)
+			return
 		}
+		setCacheControl(w, cache)
+		setStaleHeader(w, data)
+		json.NewEncoder(w).Encode(toV2(data))
 	}
+}
 
-	return scenarios
+// refreshHandler rebuilds the dashboard with c on demand, at most once
+// per c.RefreshInterval with bursts of up to c.RefreshBurst.
+func refreshHandler(c Config) http.HandlerFunc {
+	limiter := newTokenBucket(c.RefreshBurst, c.RefreshInterval)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if token := c.RefreshToken; token != "" &&
+			subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Refresh-Token")), []byte(token)) != 1 {
+			writeJSONError(w, http.StatusForbidden, "refresh requires a valid X-Refresh-Token header")
+			return
+		}
+		if ok, wait := limiter.Allow(); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeJSONError(w, http.StatusTooManyRequests, fmt.Sprintf(
+				"Refresh was triggered recently, please try again in %ds.", int(math.Ceil(wait.Seconds()))))
+			return
+		}
+
+		log.Println("\n🔄 Force refresh")
+		cache.Clear()
+		cache.builds.Forget()
+
+		data, err, _ := cache.builds.Do(func() (*DashboardData, error) {
+			data, err := buildDashboard(c)
+			if err == nil {
+				cache.Set(data)
+			}
+			return data, err
+		})
+		if err != nil {
+			writeBuildError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(data)
+	}
 }
 
-func makeProjectionPoints(startDay int, startVal, slope, totalDays float64,
-	startDate time.Time, n int) []ScenarioPoint {
-	pts := make([]ScenarioPoint, n)
-	for i := 0; i < n; i++ {
-		d := totalDays * float64(i) / float64(n-1)
-		pts[i] = ScenarioPoint{
-			X:         float64(startDay) + d,
-			Y:         startVal + slope*d,
-			HoverDate: startDate.Add(time.Duration(d*24) * time.Hour).Format("02 Jan 2006"),
+// healthHandler serves /api/health, judging data age by c's date.
+func healthHandler(c Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		resp := map[string]interface{}{
+			"status":  "ok",
+			"probe":   "liveness: 200 while the server is up; see /readyz for readiness",
+			"hasData": cache.Get() != nil,
+			"time":    time.Now().Format(time.RFC3339),
+		}
+		if t := cache.LastFetched(); !t.IsZero() {
+			resp["lastFetched"] = t.Format(time.RFC3339)
+		}
+		buildStatus.report(resp)
+		agsiBreaker.report(resp)
+		hits, misses, ratio := cache.HitRatio()
+		resp["cache"] = map[string]interface{}{
+			"hits":     hits,
+			"misses":   misses,
+			"hitRatio": ratio,
+			"ttl":      cache.ttl.String(),
+		}
+		resp["streamClients"] = streamHub.Len()
+		if avg := apiLatency.Average(); avg > 0 {
+			resp["apiLatencyMs"] = avg.Milliseconds()
+			resp["fetchDelay"] = apiLatency.Delay().String()
+		}
+		if data := cache.Latest(); data != nil {
+			if last, ok := data.lastRecord(); ok {
+				hours, stale := dataAge(c, last.Date)
+				resp["dataAgeHours"] = hours
+				resp["stale"] = stale
+				if stale {
+					resp["status"] = "degraded"
+				}
+			}
 		}
+		json.NewEncoder(w).Encode(resp)
 	}
-	return pts
 }
 
-func linearRegression(records []DayRecord) (slope, intercept float64) {
-	n := float64(len(records))
-	if n < 2 {
-		return 0, 0
+// versionHandler serves /api/version: the build information set via
+// -ldflags and the configuration c the running process actually uses.
+func versionHandler(c Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		v := version
+		if v == "" {
+			v = "dev"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"version":   v,
+			"commit":    commit,
+			"buildTime": buildTime,
+			"goVersion": runtime.Version(),
+			"config": map[string]interface{}{
+				"country":           c.Country,
+				"cacheTTL":          c.CacheTTL.String(),
+				"historySeasons":    c.HistorySeasons,
+				"criticalThreshold": c.Critical,
+				"source":            activeSource.Name(),
+			},
+		})
 	}
-	var sx, sy, sxy, sx2 float64
-	for _, r := range records {
-		x := float64(r.DaysElapsed)
-		sx += x
-		sy += r.Full
-		sxy += x * r.Full
-		sx2 += x * x
-	}
-	d := n*sx2 - sx*sx
-	if math.Abs(d) < 1e-10 {
-		return 0, sy / n
-	}
-	slope = (n*sxy - sx*sy) / d
-	intercept = (sy - slope*sx) / n
-	return
 }
 
-// ─── KPI ────────────────────────────────────────────────────
+// handleReady is the readiness probe: 503 until the first build has
+// populated the cache, 200 from then on.
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ready := cache.Ready()
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ready": ready,
+		"probe": "readiness: 503 until data has been loaded once; see /api/health for liveness",
+	})
+}
 
-func buildKPI(records []DayRecord, scenarios []Scenario) KPIData {
-	last := records[len(records)-1]
-	kpi := KPIData{
-		CurrentFill: last.Full,
-		CurrentDate: last.Date.Format("02 Jan 2006"),
-		DaysToCrit:  999,
+// handleStream serves /api/stream, a Server-Sent Events feed that
+// sends the current dashboard on connect and every fresh build after
+// that as a "dashboard" event.
+func handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
 	}
-	if len(records) >= 7 {
-		kpi.Delta7D = last.Full - records[len(records)-7].Full
+	ch, ok := streamHub.Subscribe()
+	if !ok {
+		writeJSONError(w, http.StatusServiceUnavailable, "too many stream clients")
+		return
 	}
-	start := len(records) - 7
-	if start < 0 {
-		start = 0
+	defer streamHub.Unsubscribe(ch)
+
+	// The server's WriteTimeout would cut long-lived streams.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	send := func(d *DashboardData) error {
+		body, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: dashboard\ndata: %s\n\n", body); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
 	}
-	sum := 0.0
-	for _, r := range records[start:] {
-		sum += r.Withdrawal
+	if d := cache.Latest(); d != nil {
+		if send(d) != nil {
+			return
+		}
+	} else {
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
 	}
-	kpi.AvgWithdrawal = sum / float64(len(records)-start)
-	for _, s := range scenarios {
-		if s.Name == "Linear" && s.DaysLeft > 0 {
-			kpi.DaysToCrit = s.DaysLeft
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case d, ok := <-ch:
+			if !ok || send(d) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
 		}
 	}
-	return kpi
 }
 
-// ─── Ticks ──────────────────────────────────────────────────
+// handleChartSVG serves /api/chart.svg, the cached dashboard rendered as
+// a static image. ?width= and ?height= set its size in pixels.
+func handleChartSVG(w http.ResponseWriter, r *http.Request) {
+	size := [2]int{defaultChartWidth, defaultChartHeight}
+	for i, name := range []string{"width", "height"} {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minChartSize || n > maxChartSize {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf(
+				"%s must be an integer between %d and %d", name, minChartSize, maxChartSize))
+			return
+		}
+		size[i] = n
+	}
 
-func generateTicks(startYear int) ([]int, []string) {
-	var vals []int
-	var labels []string
-	startStr := fmt.Sprintf("%d-%s", startYear, winterStartMD)
-	start, _ := time.Parse("2006-01-02", startStr)
-	for d := 0; d < 182; d += 7 {
-		vals = append(vals, d)
-		labels = append(labels, start.AddDate(0, 0, d).Format("02 Jan"))
+	data := cache.Latest()
+	if data == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "no dashboard data loaded yet")
+		return
 	}
-	return vals, labels
+	setCacheControl(w, cache)
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Write(renderChartSVG(data, size[0], size[1]))
 }
 
-// ─── Dashboard Builder ─────────────────────────────────────
+// scenariosHandler recomputes the projections from the cached data
+// with a caller-chosen regression window, leaving the cache as-is.
+func scenariosHandler(c Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
 
-func buildDashboard() (*DashboardData, error) {
-	log.Println("\n════════════════════════════════════════")
-	log.Println("  📡 Building Dashboard")
-	log.Println("════════════════════════════════════════")
+		window := trendWindow
+		if v := r.URL.Query().Get("window"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < minTrendWindow || n > maxTrendWindow {
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf(
+					"window must be an integer between %d and %d", minTrendWindow, maxTrendWindow))
+				return
+			}
+			window = n
+		}
 
-	now := time.Now()
-	cwsy := currentWinterStartYear()
-
-	log.Printf("  📅 Today: %s", now.Format("02 Jan 2006"))
-	log.Printf("  📅 Current winter start year: %d (season %d/%02d)",
-		cwsy, cwsy, (cwsy+1)%100)
-
-	// Build season configs: 4 prior + current (5 total)
-	configs := []SeasonConfig{
-		{
-			Year:  cwsy - 4,
-			Name:  fmt.Sprintf("Winter %d/%02d", cwsy-4, (cwsy-3)%100),
-			Color: "#bdc3c7", Width: 2, Dash: "dot",
-			FillColor: "rgba(189,195,199,0.05)",
-			IsCurrent: false,
-		},
-		{
-			Year:  cwsy - 3,
-			Name:  fmt.Sprintf("Winter %d/%02d", cwsy-3, (cwsy-2)%100),
-			Color: "#7f8c8d", Width: 2, Dash: "dot",
-			FillColor: "rgba(127,140,141,0.06)",
-			IsCurrent: false,
-		},
-		{
-			Year:  cwsy - 2,
-			Name:  fmt.Sprintf("Winter %d/%02d", cwsy-2, (cwsy-1)%100),
-			Color: "#7c3aed", Width: 3, Dash: "solid",
-			FillColor: "rgba(124,58,237,0.08)",
-			IsCurrent: false,
-		},
-		{
-			Year:  cwsy - 1,
-			Name:  fmt.Sprintf("Winter %d/%02d", cwsy-1, cwsy%100),
-			Color: "#059669", Width: 3, Dash: "solid",
-			FillColor: "rgba(5,150,105,0.10)",
-			IsCurrent: false,
-		},
-		{
-			Year:  cwsy,
-			Name:  fmt.Sprintf("Winter %d/%02d (Current)", cwsy, (cwsy+1)%100),
-			Color: "#2563eb", Width: 4, Dash: "solid",
-			FillColor: "rgba(37,99,235,0.18)",
-			IsCurrent: true,
-		},
+		data := cache.Latest()
+		if data == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "no dashboard data loaded yet")
+			return
+		}
+
+		records := data.analysisRecords()
+		scenarios, note := generateScenarios(c, records, data.seasonMap(),
+			data.CurrentYear, window)
+		daysToCrit := 999
+		for _, s := range scenarios {
+			if s.Name == "Linear" && s.DaysLeft > 0 {
+				daysToCrit = max(s.DaysLeft-originLag(c, records), 0)
+			}
+		}
+		resp := map[string]interface{}{
+			"window":     window,
+			"scenarios":  scenarios,
+			"daysToCrit": daysToCrit,
+		}
+		if note != "" {
+			resp["scenarioNote"] = note
+		}
+		json.NewEncoder(w).Encode(resp)
 	}
+}
 
-	allSeasons, seasons := fetchAllSeasons(configs)
+// handleMonthly serves per-month aggregates over all loaded seasons
+// for a long-term view.
+func handleMonthly(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	if len(seasons) == 0 {
-		return nil, fmt.Errorf("no season data loaded from API")
+	data := cache.Latest()
+	if data == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "no dashboard data loaded yet")
+		return
 	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"generatedAt": data.GeneratedAt,
+		"months":      monthlyFor(data),
+	})
+}
 
-	// Find the current season records
-	var currentRecords []DayRecord
-	var currentFound bool
+// handleAt serves /api/at?day=<n>: every loaded season's values at
+// DaysElapsed n, from the last good build.
+func handleAt(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	if r, ok := allSeasons[cwsy]; ok && len(r) > 0 {
-		currentRecords = r
-		currentFound = true
-		log.Printf("\n  ✅ Current season %d: %d records", cwsy, len(r))
+	data := cache.Latest()
+	if data == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "no dashboard data loaded yet")
+		return
 	}
-
-	if !currentFound {
-		// Fallback: use the most recent season with data
-		for i := len(seasons) - 1; i >= 0; i-- {
-			if len(seasons[i].Records) > 0 {
-				currentRecords = seasons[i].Records
-				// Mark it as current
-				seasons[i].Config.IsCurrent = true
-				log.Printf("\n  ⚠️  Fallback: using %s as current (%d records)",
-					seasons[i].Config.Name, len(currentRecords))
-				currentFound = true
-				break
-			}
+	lastDay := 0
+	for _, s := range data.Seasons {
+		if n := len(s.Records); n > 0 {
+			lastDay = max(lastDay, s.Records[n-1].DaysElapsed)
 		}
 	}
-
-	if !currentFound {
-		return nil, fmt.Errorf("no usable current season data")
+	day, err := strconv.Atoi(r.URL.Query().Get("day"))
+	if err != nil || day < 0 || day > lastDay {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf(
+			"day must be an integer between 0 and %d", lastDay))
+		return
 	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"generatedAt": data.GeneratedAt,
+		"units":       data.Units,
+		"day":         day,
+		"seasons":     seasonsAtDay(data.Seasons, day),
+	})
+}
 
-	// Debug: verify trend data exists
-	nonZeroTrend := 0
-	for _, r := range currentRecords {
-		if r.Trend != 0 {
-			nonZeroTrend++
+// compareHandler serves /api/compare?a=<year>&b=<year>, aligning two
+// winters by day of season.
+func compareHandler(c Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var years [2]int
+		for i, name := range []string{"a", "b"} {
+			n, err := strconv.Atoi(r.URL.Query().Get(name))
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf(
+					"%s must be a season start year", name))
+				return
+			}
+			if err := c.Calendar.ValidateYear(n); err != nil {
+				writeJSONError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			years[i] = n
 		}
-	}
-	log.Printf("  📊 Current season: %d records, %d with non-zero trend",
-		len(currentRecords), nonZeroTrend)
 
-	scenarios := generateScenarios(currentRecords, allSeasons, cwsy)
-	kpi := buildKPI(currentRecords, scenarios)
-	tv, tl := generateTicks(cwsy)
+		var records [2][]DayRecord
+		var warming []int
+		for i, year := range years {
+			rec, ok, err := warmer.Load(c.Calendar, year, c.WarmWait)
+			if errors.Is(err, ErrEmptyData) {
+				writeJSONError(w, http.StatusNotFound, fmt.Sprintf("no data for season %d", year))
+				return
+			}
+			if err != nil {
+				writeJSONError(w, http.StatusBadGateway, fmt.Sprintf(
+					"loading season %d: %v", year, err))
+				return
+			}
+			if !ok {
+				warming = append(warming, year)
+				continue
+			}
+			if len(rec) == 0 {
+				writeJSONError(w, http.StatusNotFound, fmt.Sprintf("no data for season %d", year))
+				return
+			}
+			records[i] = rec
+		}
+		if len(warming) > 0 {
+			writeWarming(w, warming)
+			return
+		}
 
-	log.Printf("\n  ✅ Dashboard built:")
-	log.Printf("     Seasons   : %d", len(seasons))
-	log.Printf("     Scenarios : %d", len(scenarios))
-	log.Printf("     Fill      : %.1f%% as of %s", kpi.CurrentFill, kpi.CurrentDate)
-	log.Printf("     7d Δ      : %.2f%%", kpi.Delta7D)
-	log.Printf("     Avg withdrawal: %.0f GWh/d", kpi.AvgWithdrawal)
-	if kpi.DaysToCrit < 999 {
-		log.Printf("     Days to critical: ~%d", kpi.DaysToCrit)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"a":    summarizeSeason(c.Calendar, years[0], records[0]),
+			"b":    summarizeSeason(c.Calendar, years[1], records[1]),
+			"days": alignSeasons(records[0], records[1]),
+		})
 	}
+}
 
-	return &DashboardData{
-		Seasons:     seasons,
-		Scenarios:   scenarios,
-		KPI:         kpi,
-		TickVals:    tv,
-		TickLabels:  tl,
-		GeneratedAt: now.Format("02 Jan 2006 15:04"),
-		CurrentYear: cwsy,
-	}, nil
+// writeWarming answers 202 while requested seasons are still loading.
+func writeWarming(w http.ResponseWriter, years []int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "5")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "warming",
+		"years":  years,
+	})
 }
 
-// ─── HTTP Handlers ──────────────────────────────────────────
+// handleSchema serves the JSON Schema of /api/data, or of
+// /api/data.v2 with ?version=2.
+func handleSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
 
-func handleDashboard(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
-		return
-	}
-	tmpl, err := template.ParseFiles("templates/dashboard.html")
-	if err != nil {
-		http.Error(w, "Template error: "+err.Error(), 500)
-		return
+	switch r.URL.Query().Get("version") {
+	case "", "1":
+		json.NewEncoder(w).Encode(schemaDocument(DashboardData{}, "DashboardData",
+			"Response of /api/data: seasons with daily records, scenarios, KPIs and axis ticks."))
+	case "2":
+		json.NewEncoder(w).Encode(schemaDocument(DashboardV2{}, "DashboardV2",
+			"Response of /api/data.v2: plot series separated from their styles."))
+	default:
+		writeJSONError(w, http.StatusBadRequest, "version must be 1 or 2")
 	}
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	tmpl.Execute(w, nil)
 }
 
-func handleAPI(w http.ResponseWriter, r *http.Request) {
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
 
-	if cached := cache.Get(); cached != nil {
-		log.Println("📦 Serving cached data")
-		json.NewEncoder(w).Encode(cached)
-		return
-	}
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history.All())
+}
 
-	cache.building.Lock()
-	defer cache.building.Unlock()
+// ─── CORS ───────────────────────────────────────────────────
 
-	if cached := cache.Get(); cached != nil {
-		json.NewEncoder(w).Encode(cached)
-		return
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if p := strings.TrimSpace(part); p != "" {
+			out = append(out, p)
+		}
 	}
+	return out
+}
 
-	data, err := buildDashboard()
-	if err != nil {
-		w.WriteHeader(500)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error":   err.Error(),
-			"message": "Failed to build dashboard.",
-			"hint":    "Set AGSI_API_KEY env var if API requires auth.",
-		})
-		return
+func corsAllowOrigin(origins []string, origin string) string {
+	for _, o := range origins {
+		if o == "*" {
+			return "*"
+		}
+		if strings.EqualFold(o, origin) {
+			return origin
+		}
 	}
-	cache.Set(data)
-	json.NewEncoder(w).Encode(data)
+	return ""
 }
 
-func handleRefresh(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	log.Println("\n🔄 Force refresh")
-	cache.Clear()
+// normalizeBasePath returns BASE_PATH normalized to "/prefix" without
+// a trailing slash, or "" when the dashboard is served from the root.
+func normalizeBasePath(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// withBasePath strips prefix from request paths, for a reverse proxy
+// that forwards /prefix/... unchanged. Paths without the prefix pass
+// through as-is, so a proxy that strips it itself and probes that hit
+// the pod directly keep working.
+func withBasePath(prefix string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == prefix:
+			http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+			return
+		case strings.HasPrefix(r.URL.Path, prefix+"/"):
+			http.StripPrefix(prefix, next).ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-	cache.building.Lock()
-	defer cache.building.Unlock()
+// newCORS returns middleware that adds Access-Control-Allow-* headers
+// for origins (from CORS_ORIGINS: comma separated, or "*") and answers
+// preflight requests. No origins means same-origin only.
+func newCORS(origins []string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return corsHandler(origins, next)
+	}
+}
 
-	data, err := buildDashboard()
-	if err != nil {
-		w.WriteHeader(500)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		return
+func corsHandler(origins []string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || len(origins) == 0 {
+			next(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allow := corsAllowOrigin(origins, origin)
+		if allow == "" {
+			next(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allow)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next(w, r)
 	}
-	cache.Set(data)
-	json.NewEncoder(w).Encode(data)
 }
 
-func handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "ok",
-		"hasData": cache.Get() != nil,
-		"time":    time.Now().Format(time.RFC3339),
-	})
+// ─── Request Limits ─────────────────────────────────────────
+
+// newLimits returns middleware that caps the request body at
+// maxRequestBody and answers 503 once timeout (HANDLER_TIMEOUT)
+// elapses, so a slow client or a stuck upstream fetch cannot hold a
+// connection indefinitely. A build that is already running keeps going
+// in the background and still fills the cache.
+func newLimits(timeout time.Duration) func(http.HandlerFunc) http.Handler {
+	return func(next http.HandlerFunc) http.Handler {
+		limited := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+			next(w, r)
+		})
+		return http.TimeoutHandler(limited, timeout, `{"error":"request timed out"}`)
+	}
 }
 
 // ─── Port Discovery ─────────────────────────────────────────
 
-func findAvailablePort(preferred string) string {
-	ln, err := net.Listen("tcp", ":"+preferred)
+var defaultFallbackPorts = []string{"8081", "8082", "8083", "8090", "9090"}
+
+// findAvailablePort returns c.Port if it is free. Otherwise it tries
+// c.FallbackPorts and finally a random port, unless c.StrictPort, in
+// which case a busy port is fatal.
+func findAvailablePort(c Config) string {
+	ln, err := net.Listen("tcp", ":"+c.Port)
 	if err == nil {
 		ln.Close()
-		return preferred
+		return c.Port
+	}
+	if c.StrictPort {
+		log.Fatalf("❌ Port %s busy and STRICT_PORT=1 set: %v", c.Port, err)
 	}
-	log.Printf("⚠️  Port %s busy: %v", preferred, err)
+	log.Printf("⚠️  Port %s busy: %v", c.Port, err)
 
-	for _, p := range []string{"8081", "8082", "8083", "8090", "9090"} {
+	for _, p := range c.FallbackPorts {
 		if ln, err := net.Listen("tcp", ":"+p); err == nil {
 			ln.Close()
 			log.Printf("✅ Using port %s", p)
@@ -771,64 +5774,193 @@ func findAvailablePort(preferred string) string {
 	return port
 }
 
+// ─── Check Mode ─────────────────────────────────────────────
+
+// runCheck builds the dashboard once and writes the KPI block to
+// stdout. The exit code is 0 when healthy, 1 when the build failed
+// and 2 when the data is stale.
+func runCheck(c Config) int {
+	data, err := buildDashboard(c)
+	if err != nil {
+		log.Printf("❌ Check failed: %v", err)
+		return 1
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data.KPI); err != nil {
+		log.Printf("❌ Writing KPI: %v", err)
+		return 1
+	}
+	if data.KPI.Stale {
+		log.Printf("⚠️  Data is stale (%.1fh old)", data.KPI.DataAgeHours)
+		return 2
+	}
+	return 0
+}
+
+// ─── Debug Server ───────────────────────────────────────────
+
+// startDebugServer serves net/http/pprof on its own listener
+// (DEBUG_PPROF_ADDR, default localhost:6060) so profiles are never
+// reachable through the public port.
+func startDebugServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		log.Printf("  🩺 pprof:    http://%s/debug/pprof/", addr)
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			log.Printf("❌ Debug server failed: %v", err)
+		}
+	}()
+	return srv
+}
+
+// ─── TLS ────────────────────────────────────────────────────
+
+// tlsConfig restricts the server to TLS 1.2+ with forward-secret
+// AEAD suites. TLS 1.3 suites are chosen by Go and not listed here.
+func tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		},
+	}
+}
+
 // ─── Main ───────────────────────────────────────────────────
 
 func main() {
-	preferred := defaultPort
-	if p := os.Getenv("PORT"); p != "" {
-		preferred = p
+	cfg, err := loadConfig()
+	setupLogging(cfg.PlainLogs)
+	if err != nil {
+		log.Fatalf("❌ Invalid configuration: %v", err)
 	}
+	displayLoc = cfg.DisplayLoc
+	history = newHistory(cfg.HistorySize)
+	buildStatus = newBuildStatus(cfg.BackoffBase, cfg.BackoffMax)
+	apiLatency = newLatencyTracker(cfg.FetchDelayMin, cfg.FetchDelayMax)
+	activeSource = newDataSource(cfg)
+	agsiBreaker = newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)
+	drawdownAlert = newDrawdownAlert(cfg.DrawdownPct, cfg.DrawdownHysteresis, cfg.AlertWebhookURL)
+	cache.ttl = cfg.CacheTTL
+	cache.builds.shareWindow = cfg.BuildShareWindow
 
-	port := findAvailablePort(preferred)
+	if cfg.Check {
+		os.Exit(runCheck(cfg))
+	}
+
+	port := findAvailablePort(cfg)
 	addr := ":" + port
+	withCORS := newCORS(cfg.CORSOrigins)
+	withLimits := newLimits(cfg.HandlerTimeout)
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", handleDashboard)
-	mux.HandleFunc("/api/data", handleAPI)
-	mux.HandleFunc("/api/refresh", handleRefresh)
-	mux.HandleFunc("/api/health", handleHealth)
+	mux.Handle("/", withLimits(dashboardHandler(cfg.BasePath)))
+	mux.HandleFunc("/favicon.ico", handleFavicon)
+	mux.Handle("/api/data", withLimits(withCORS(apiHandler(cfg))))
+	mux.Handle("/api/data.v2", withLimits(withCORS(apiV2Handler(cfg))))
+	mux.Handle("/api/refresh", withLimits(refreshHandler(cfg)))
+	mux.HandleFunc("/api/health", healthHandler(cfg))
+	mux.HandleFunc("/readyz", handleReady)
+	mux.HandleFunc("/api/version", withCORS(versionHandler(cfg)))
+	mux.HandleFunc("/api/history", withCORS(handleHistory))
+	mux.Handle("/api/scenarios", withLimits(withCORS(scenariosHandler(cfg))))
+	mux.Handle("/api/compare", withLimits(withCORS(compareHandler(cfg))))
+	mux.HandleFunc("/api/at", withCORS(handleAt))
+	mux.HandleFunc("/api/schema", withCORS(handleSchema))
+	mux.HandleFunc("/api/monthly", withCORS(handleMonthly))
+	mux.Handle("/api/chart.svg", withLimits(withCORS(handleChartSVG)))
+	mux.HandleFunc("/api/stream", withCORS(handleStream))
+
+	var handler http.Handler = mux
+	base := cfg.BasePath
+	if base != "" {
+		handler = withBasePath(base, mux)
+	}
 
 	server := &http.Server{
 		Addr:         addr,
-		Handler:      mux,
+		Handler:      handler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 120 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	server.RegisterOnShutdown(streamHub.Close)
 
-	cwsy := currentWinterStartYear()
+	useTLS := cfg.useTLS()
+	scheme := "http"
+	if useTLS {
+		server.TLSConfig = tlsConfig()
+		scheme = "https"
+	}
+
+	cwsy := cfg.Calendar.CurrentStartYear()
 
 	log.Println("══════════════════════════════════════════")
 	log.Println("  🚀 German Gas Storage Dashboard")
 	log.Println("══════════════════════════════════════════")
-	log.Printf("  Dashboard:  http://localhost:%s", port)
-	log.Printf("  API:        http://localhost:%s/api/data", port)
-	log.Printf("  Health:     http://localhost:%s/api/health", port)
-	log.Printf("  Season:     Winter %d/%02d", cwsy, (cwsy+1)%100)
+	log.Printf("  Dashboard:  %s://localhost:%s%s/", scheme, port, base)
+	log.Printf("  API:        %s://localhost:%s%s/api/data", scheme, port, base)
+	log.Printf("  Health:     %s://localhost:%s%s/api/health", scheme, port, base)
+	log.Printf("  Season:     %s", cfg.Calendar.Name(cwsy))
+	if version != "" {
+		log.Printf("  Version:    %s (%s, built %s)", version, commit, buildTime)
+	}
 	log.Println()
-	if apiKey := os.Getenv("AGSI_API_KEY"); apiKey != "" {
+	if useTLS {
+		log.Println("  🔒 TLS:     enabled")
+	}
+	if dir, ok := cfg.fixtureDir(); ok {
+		log.Printf("  📂 Source:   fixtures in %s", dir)
+	} else if cfg.APIKey != "" {
 		log.Println("  🔑 API Key: configured")
 	} else {
 		log.Println("  ⚠️  No API key. Set AGSI_API_KEY if needed.")
 	}
 	log.Println()
+	logConfig(cfg)
+	log.Println()
 	log.Println("  Press Ctrl+C to stop")
 	log.Println("══════════════════════════════════════════")
 
-	// Pre-fetch
-	go func() {
-		log.Println("\n🔄 Pre-fetching...")
-		cache.building.Lock()
-		defer cache.building.Unlock()
+	// Pre-fetch, unless disabled with PREFETCH=0; the first request
+	// then builds lazily.
+	if !cfg.Prefetch {
+		log.Println("⏭️  Pre-fetch disabled (PREFETCH=0), building on first request")
+	} else {
+		go func() {
+			log.Println("\n🔄 Pre-fetching...")
+			_, err, _ := cache.builds.Do(func() (*DashboardData, error) {
+				data, err := buildDashboard(cfg)
+				if err == nil {
+					cache.Set(data)
+				}
+				return data, err
+			})
+			if err != nil {
+				log.Printf("⚠️  Pre-fetch failed: %v", err)
+			} else {
+				log.Println("✅ Ready!")
+			}
+		}()
+	}
 
-		data, err := buildDashboard()
-		if err != nil {
-			log.Printf("⚠️  Pre-fetch failed: %v", err)
-		} else {
-			cache.Set(data)
-			log.Println("✅ Ready!")
-		}
-	}()
+	var debugServer *http.Server
+	if cfg.Pprof {
+		debugServer = startDebugServer(cfg.PprofAddr)
+	}
 
 	// Graceful shutdown
 	stop := make(chan os.Signal, 1)
@@ -839,12 +5971,22 @@ func main() {
 		log.Println("\n🛑 Shutting down...")
 		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 		defer cancel()
+		if debugServer != nil {
+			if err := debugServer.Shutdown(ctx); err != nil {
+				log.Printf("❌ Debug server shutdown error: %v", err)
+			}
+		}
 		if err := server.Shutdown(ctx); err != nil {
 			log.Printf("❌ Shutdown error: %v", err)
 		}
 	}()
 
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+	if useTLS {
+		err = server.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
 		log.Fatalf("❌ Server failed: %v", err)
 	}
 	log.Println("👋 Bye!")
@@ -0,0 +1,1069 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// approx reports whether a and b agree to within 1e-9.
+func approx(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+// dayRecords builds consecutive gas days from fill levels, starting at
+// start with DaysElapsed 0.
+func dayRecords(start time.Time, fills ...float64) []DayRecord {
+	records := make([]DayRecord, len(fills))
+	for i, f := range fills {
+		records[i] = DayRecord{Date: start.AddDate(0, 0, i), Full: f, DaysElapsed: i}
+	}
+	return records
+}
+
+func TestCalendarTrendsSkipsLeadingZero(t *testing.T) {
+	records := dayRecords(time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC), 90, 89, 88, 87)
+	calendarTrends(records, 0.3)
+
+	if records[0].Trend != 0 || records[0].TrendMA7 != 0 {
+		t.Errorf("day 1: trend %g, MA7 %g, want 0, 0", records[0].Trend, records[0].TrendMA7)
+	}
+	// A steady -1/day decline must read -1 from day 2 on, not -0.5.
+	for i := 1; i < len(records); i++ {
+		if r := records[i]; !approx(r.TrendMA7, -1) || !approx(r.TrendEWMA, -1) {
+			t.Errorf("day %d: MA7 %g, EWMA %g, want -1", i+1, r.TrendMA7, r.TrendEWMA)
+		}
+	}
+}
+
+func TestParseFloatLocalized(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"85.3", 85.3},
+		{"85,3", 85.3},
+		{" 85,30 ", 85.3},
+		{"1.234,5", 1234.5},
+		{"1,234.5", 1234.5},
+		{"1 234,5", 1234.5},
+		{"1\u00a0234,5", 1234.5},
+		{"1.234.567", 1234567},
+		{"1,234,567", 1234567},
+		{"1,234", 1.234}, // a single comma is a decimal mark
+		{"-0,5", -0.5},
+		{"", 0},
+		{"-", 0},
+		{"N/A", 0},
+	}
+	for _, tt := range tests {
+		if got := parseFloat(tt.in); !approx(got, tt.want) {
+			t.Errorf("parseFloat(%q) = %g, want %g", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseFloatCountsFailures(t *testing.T) {
+	before := parseFailures.Load()
+	if got := parseFloat("-"); got != 0 {
+		t.Errorf(`parseFloat("-") = %g, want 0`, got)
+	}
+	if n := parseFailures.Load() - before; n != 0 {
+		t.Errorf("placeholder counted as %d failure(s)", n)
+	}
+	if got := parseFloat("85%"); got != 0 {
+		t.Errorf(`parseFloat("85%%") = %g, want 0`, got)
+	}
+	if n := parseFailures.Load() - before; n != 1 {
+		t.Errorf("failures = %d, want 1", n)
+	}
+}
+
+func TestWinterStartYearAt(t *testing.T) {
+	tests := []struct {
+		date string
+		want int
+	}{
+		{"2025-10-31", 2024},
+		{"2025-11-01", 2025},
+		{"2025-12-31", 2025},
+		{"2026-01-01", 2025},
+		{"2026-03-31", 2025},
+	}
+	for _, tt := range tests {
+		d, err := time.ParseInLocation("2006-01-02", tt.date, displayLoc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := winterStartYearAt(d); got != tt.want {
+			t.Errorf("winterStartYearAt(%s) = %d, want %d", tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestSummerCalendar(t *testing.T) {
+	cal := defaultConfig().Calendar
+	cal.Summer, cal.SummerStart, cal.SummerEnd = true, "05-01", "09-30"
+	cal.AsOf = time.Date(2026, 4, 15, 0, 0, 0, 0, displayLoc)
+	// Mid-April is before the window opens, so 2025 is still current.
+	if got := cal.CurrentStartYear(); got != 2025 {
+		t.Errorf("CurrentStartYear on 15 Apr 2026 = %d, want 2025", got)
+	}
+	if got, want := cal.StartDate(2026)+" "+cal.EndDate(2026), "2026-05-01 2026-09-30"; got != want {
+		t.Errorf("2026 window = %s, want %s", got, want)
+	}
+	if got := cal.Days(2026); got != 153 {
+		t.Errorf("Days(2026) = %d, want 153", got)
+	}
+	if got := cal.Name(2026); got != "Summer 2026" {
+		t.Errorf("Name(2026) = %q", got)
+	}
+	cal.Summer = false
+	if got := cal.Name(2025); got != "Winter 2025/26" {
+		t.Errorf("winter Name(2025) = %q", got)
+	}
+}
+
+func TestCalendarYearRange(t *testing.T) {
+	cal := defaultConfig().Calendar
+	cal.AsOf = time.Date(2024, 1, 15, 0, 0, 0, 0, displayLoc)
+	for _, tt := range []struct{ yearMax, want int }{{0, 2023}, {2030, 2023}, {2020, 2020}} {
+		cal.YearMax = tt.yearMax
+		if lo, hi := cal.YearRange(); lo != firstSeasonYear || hi != tt.want {
+			t.Errorf("YearMax %d: range %d–%d, want %d–%d", tt.yearMax, lo, hi, firstSeasonYear, tt.want)
+		}
+	}
+	if err := cal.ValidateYear(2021); !errors.Is(err, ErrSeasonRange) {
+		t.Errorf("ValidateYear(2021) above YearMax 2020 = %v, want ErrSeasonRange", err)
+	}
+}
+
+// seasonOf builds n days of the 2024/25 winter declining by slope
+// percentage points per day from 80%.
+func seasonOf(n int, slope float64) []DayRecord {
+	fills := make([]float64, n)
+	for i := range fills {
+		fills[i] = 80 + slope*float64(i)
+	}
+	return dayRecords(time.Date(2024, 11, 1, 0, 0, 0, 0, displayLoc), fills...)
+}
+
+func TestGenerateScenariosNearZeroSlope(t *testing.T) {
+	scenarios, _ := generateScenarios(defaultConfig(), seasonOf(30, -0.0001), nil, 2024, trendWindow)
+	for _, s := range scenarios {
+		if s.Name == "Linear" || s.Name == "Stress" {
+			t.Errorf("%s scenario emitted for a near-flat trend: %d days left, %d points",
+				s.Name, s.DaysLeft, len(s.Points))
+		}
+	}
+}
+
+func TestGenerateScenariosLinearHit(t *testing.T) {
+	scenarios, _ := generateScenarios(defaultConfig(), seasonOf(30, -0.5), nil, 2024, trendWindow)
+	for _, s := range scenarios {
+		if s.Name != "Linear" {
+			continue
+		}
+		// 65.5% at day 29, 55.5 points above critical at 0.5/day.
+		if s.DaysLeft != 111 {
+			t.Errorf("DaysLeft = %d, want 111", s.DaysLeft)
+		}
+		if last := s.Points[len(s.Points)-1]; math.Abs(last.X-(29+111)) > 1 || math.Abs(last.Y-defaultCritical) > 0.5 {
+			t.Errorf("projection ends at (%g, %g), want (~140, ~%g)", last.X, last.Y, defaultCritical)
+		}
+		return
+	}
+	t.Fatal("no Linear scenario")
+}
+
+func TestWeightedRegressionFollowsAcceleration(t *testing.T) {
+	// The decline steepens by 0.02 points/day each day, to -0.26/day
+	// at the end.
+	fills := make([]float64, 14)
+	for i := range fills {
+		fills[i] = 80 - 0.01*float64(i*i)
+	}
+	records := dayRecords(time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC), fills...)
+
+	plain, _, _ := linearRegression(records)
+	weighted, _, _ := weightedLinearRegression(records, 3)
+	if !(weighted < plain) {
+		t.Errorf("weighted slope %g should be steeper than plain %g", weighted, plain)
+	}
+	if weighted < -0.26 {
+		t.Errorf("weighted slope %g steeper than the latest day-over-day change", weighted)
+	}
+
+	// On an exact line the weights don't matter.
+	line := seasonOf(14, -0.4)
+	if s, i, r2 := weightedLinearRegression(line, 3); !approx(s, -0.4) || !approx(i, 80) || !approx(r2, 1) {
+		t.Errorf("weighted fit of a line = %g, %g, R² %g, want -0.4, 80, 1", s, i, r2)
+	}
+}
+
+func TestRegressionFunc(t *testing.T) {
+	cfg := defaultConfig()
+	if _, name := regressionFunc(cfg); name != "linear" {
+		t.Errorf("default fit %q, want linear", name)
+	}
+	cfg.WeightedFit = true
+	if _, name := regressionFunc(cfg); name != "weighted, half-life 7d" {
+		t.Errorf("weighted fit %q, want a 7-day half-life", name)
+	}
+	cfg.HalfLife = 3
+	if _, name := regressionFunc(cfg); name != "weighted, half-life 3d" {
+		t.Errorf("weighted fit %q, want a 3-day half-life", name)
+	}
+}
+
+// offsetDays shifts DaysElapsed by off, as for a season far from its
+// origin.
+func offsetDays(records []DayRecord, off int) []DayRecord {
+	for i := range records {
+		records[i].DaysElapsed += off
+	}
+	return records
+}
+
+func TestLinearRegression(t *testing.T) {
+	sameDay := seasonOf(3, 0)
+	sameDay[0].Full, sameDay[2].Full = 70, 90
+	for i := range sameDay {
+		sameDay[i].DaysElapsed = 5
+	}
+	tests := []struct {
+		name                 string
+		records              []DayRecord
+		slope, intercept, r2 float64
+	}{
+		{"exact line", seasonOf(14, -0.5), -0.5, 80, 1},
+		{"flat", seasonOf(14, 0), 0, 80, 1},
+		{"single point", seasonOf(1, -0.5), 0, 0, 0},
+		{"empty", nil, 0, 0, 0},
+		{"same day", sameDay, 0, 80, 0},
+		{"large DaysElapsed", offsetDays(seasonOf(14, -0.5), 1e6), -0.5, 80 + 0.5e6, 1},
+	}
+	fits := map[string]func([]DayRecord) (float64, float64, float64){
+		"linear":   linearRegression,
+		"weighted": func(r []DayRecord) (float64, float64, float64) { return weightedLinearRegression(r, 7) },
+	}
+	for _, tt := range tests {
+		for name, fit := range fits {
+			slope, intercept, r2 := fit(tt.records)
+			// The intercept sits 1e6 days back in the large case.
+			if math.Abs(slope-tt.slope) > 1e-9 || math.Abs(intercept-tt.intercept) > 1e-6 ||
+				math.Abs(r2-tt.r2) > 1e-9 {
+				t.Errorf("%s, %s: got %g, %g, R² %g; want %g, %g, R² %g",
+					tt.name, name, slope, intercept, r2, tt.slope, tt.intercept, tt.r2)
+			}
+		}
+	}
+}
+
+func TestLinearRegressionR2(t *testing.T) {
+	if _, _, r2 := linearRegression(seasonOf(14, -0.5)); !approx(r2, 1) {
+		t.Errorf("R² of an exact line = %g, want 1", r2)
+	}
+
+	// A slight decline buried in ±5 points of day-to-day noise.
+	noisy := seasonOf(30, -0.5)
+	for i := range noisy {
+		noisy[i].Full += float64(5 * (1 - 2*(i%2)))
+	}
+	_, _, r2 := linearRegression(noisy[len(noisy)-trendWindow:])
+	if r2 < 0 || r2 >= defaultR2Threshold {
+		t.Errorf("R² of noisy data = %g, want in [0, %g)", r2, defaultR2Threshold)
+	}
+	scenarios, _ := generateScenarios(defaultConfig(), noisy, nil, 2024, trendWindow)
+	for _, s := range scenarios {
+		if s.Name == "Linear" && !s.LowConfidence {
+			t.Errorf("Linear scenario with R² %g not flagged low confidence", s.R2)
+		}
+	}
+	if kpi := buildKPI(defaultConfig(), noisy, scenarios); !kpi.TrendLowConfidence {
+		t.Errorf("KPI not flagged low confidence (R² %g)", kpi.TrendR2)
+	}
+}
+
+// apiDays builds AGSI records for consecutive gas days from start,
+// newest first as AGSI returns them.
+func apiDays(start string, fills ...string) []APIRecord {
+	d, _ := time.Parse("2006-01-02", start)
+	out := make([]APIRecord, len(fills))
+	for i, f := range fills {
+		out[len(fills)-1-i] = APIRecord{GasDayStart: d.AddDate(0, 0, i).Format("2006-01-02"), Full: f}
+	}
+	return out
+}
+
+func TestSeasonRecordsFlagsSeededDays(t *testing.T) {
+	// Three seed days before 1 Nov, then ten season days.
+	data := apiDays("2024-10-29", "95", "94.9", "94.8",
+		"94.7", "94.6", "94.5", "94.4", "94.3", "94.2", "94.1", "94", "93.9", "93.8")
+	records, _, err := seasonRecords(defaultConfig().Calendar, defaultConfig().Records, 2024, data, Facility{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 10 || records[0].DaysElapsed != 0 {
+		t.Fatalf("got %d records from day %d, want 10 from day 0", len(records), records[0].DaysElapsed)
+	}
+	// Day 0's trend uses the last seed day; days 0–6 average it.
+	for i, r := range records {
+		if want := i < 7; r.Seeded != want {
+			t.Errorf("day %d: Seeded = %t, want %t", r.DaysElapsed, r.Seeded, want)
+		}
+	}
+	if !approx(records[0].Trend, -0.1) {
+		t.Errorf("day 0 trend = %g, want -0.1 from the seed", records[0].Trend)
+	}
+}
+
+// fastFetches paces AGSI calls 1ms apart for the rest of the test.
+func fastFetches(t *testing.T) {
+	prev := apiLatency
+	apiLatency = newLatencyTracker(time.Millisecond, time.Millisecond)
+	t.Cleanup(func() { apiLatency = prev })
+}
+
+// newMockAGSI serves every requested range with a steady winter
+// drawdown: 95% on 1 Nov, falling 0.3 points a day.
+func newMockAGSI(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		q := r.URL.Query()
+		from, err1 := time.ParseInLocation("2006-01-02", q.Get("from"), displayLoc)
+		to, err2 := time.ParseInLocation("2006-01-02", q.Get("to"), displayLoc)
+		if err1 != nil || err2 != nil || q.Get("country") != defaultCountry {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		var data []APIRecord
+		for d := to; !d.Before(from); d = d.AddDate(0, 0, -1) {
+			start := time.Date(winterStartYearAt(d), 11, 1, 0, 0, 0, 0, displayLoc)
+			full := 95 - 0.3*math.Round(d.Sub(start).Hours()/24)
+			data = append(data, APIRecord{
+				GasDayStart:      d.Format("2006-01-02"),
+				Full:             fmt.Sprintf("%.2f", full),
+				Withdrawal:       "1500",
+				GasInStorage:     fmt.Sprintf("%.2f", full*2.5),
+				WorkingGasVolume: "250",
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(APIResponse{LastPage: 1, Data: data})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestBuildDashboardAgainstMockAGSI(t *testing.T) {
+	srv, calls := newMockAGSI(t)
+	prev := activeSource
+	cfg := defaultConfig()
+	cfg.Source, cfg.HistorySeasons, cfg.BaselineSeasons = srv.URL, 2, 0
+	cfg.Calendar.AsOf = time.Date(2024, 1, 15, 0, 0, 0, 0, displayLoc)
+	activeSource = newAGSISource(cfg)
+	t.Cleanup(func() { activeSource = prev })
+	fastFetches(t)
+
+	data, err := buildDashboard(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(data.Seasons); got != 3 {
+		t.Errorf("seasons = %d, want 3", got)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("AGSI calls = %d, want one per season", got)
+	}
+	if data.CurrentYear != 2023 {
+		t.Errorf("current year = %d, want 2023", data.CurrentYear)
+	}
+
+	// 15 Jan is day 75: 95 - 75×0.3.
+	kpi := data.KPI
+	if !approx(kpi.CurrentFill, 72.5) || !approx(kpi.Delta7D, -1.8) || !approx(kpi.AvgWithdrawal, 1500) {
+		t.Errorf("KPI fill %g, 7d Δ %g, withdrawal %g, want 72.5, -1.8, 1500",
+			kpi.CurrentFill, kpi.Delta7D, kpi.AvgWithdrawal)
+	}
+	// 62.5 points above critical at 0.3/day.
+	if kpi.DaysToCrit != 208 {
+		t.Errorf("days to critical = %d, want 208", kpi.DaysToCrit)
+	}
+
+	names := map[string]Scenario{}
+	for _, s := range data.Scenarios {
+		names[s.Name] = s
+	}
+	if s, ok := names["Linear"]; !ok || !approx(s.Slope, -0.3) || !approx(s.R2, 1) {
+		t.Errorf("Linear scenario = %+v, want slope -0.3 with R² 1", s)
+	}
+	if s, ok := names["Stress"]; !ok || s.DaysLeft != 166 {
+		t.Errorf("Stress scenario days left = %d, want 166", s.DaysLeft)
+	}
+	if _, ok := names["History"]; !ok {
+		t.Error("no History scenario")
+	}
+}
+
+func TestFetchSeasonNotModifiedReturnsCopy(t *testing.T) {
+	const lastModified = "Mon, 15 Jan 2024 10:00:00 GMT"
+	full := []APIRecord{
+		{GasDayStart: "2023-11-02", Full: "94.7"},
+		{GasDayStart: "2023-11-01", Full: "95"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Last-Modified", lastModified)
+		json.NewEncoder(w).Encode(APIResponse{LastPage: 1, Data: full})
+	}))
+	defer srv.Close()
+	cfg := defaultConfig()
+	cfg.Source = srv.URL
+	cfg.Calendar.AsOf = time.Date(2024, 1, 15, 0, 0, 0, 0, displayLoc)
+	src := newAGSISource(cfg)
+	fac := Facility{EIC: "21W000000000TEST"}
+
+	first, _, err := src.FetchSeason(context.Background(), 2022, fac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, info, err := src.FetchSeason(context.Background(), 2022, fac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.HTTPStatus != http.StatusNotModified || len(second) != len(first) {
+		t.Fatalf("second fetch: HTTP %d, %d records, want 304 with %d", info.HTTPStatus, len(second), len(first))
+	}
+	second[0].Anomaly = true
+	if first[0].Anomaly {
+		t.Error("304 reused the records of the previous build instead of a copy")
+	}
+	if again, _, _ := src.FetchSeason(context.Background(), 2022, fac); again[0].Anomaly {
+		t.Error("flags set on a build leaked into the upstream cache")
+	}
+}
+
+func TestDedupeGasDays(t *testing.T) {
+	// 2 Nov appears twice; the revision later in the response wins.
+	data := apiDays("2024-11-01", "95", "94.8", "94.5")
+	data = append(data, APIRecord{GasDayStart: "2024-11-02", Full: "94.6"})
+	records, _, err := seasonRecords(defaultConfig().Calendar, defaultConfig().Records, 2024, data, Facility{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+	for i, r := range records {
+		if r.DaysElapsed != i {
+			t.Errorf("record %d is day %d", i, r.DaysElapsed)
+		}
+	}
+	if records[1].Full != 94.6 {
+		t.Errorf("2 Nov fill = %g, want the revised 94.6", records[1].Full)
+	}
+	// No zero-day gap in the trend.
+	if !approx(records[1].Trend, -0.4) || !approx(records[2].Trend, -0.1) {
+		t.Errorf("trends %g, %g, want -0.4, -0.1", records[1].Trend, records[2].Trend)
+	}
+
+	day := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	in := []DayRecord{{Date: day, Full: 1}, {Date: day, Full: 2}, {Date: day, Full: 3}, {Date: day.AddDate(0, 0, 1), Full: 4}}
+	if out := dedupeGasDays(in); len(out) != 2 || out[0].Full != 3 || out[1].Full != 4 {
+		t.Errorf("dedupeGasDays = %+v, want fills 3 and 4", out)
+	}
+}
+
+func TestBuildErrorStatus(t *testing.T) {
+	tests := []struct {
+		err     error
+		status  int
+		keyHint bool
+	}{
+		{&APIStatusError{Code: http.StatusUnauthorized}, http.StatusBadGateway, true},
+		{&APIStatusError{Code: http.StatusForbidden}, http.StatusBadGateway, true},
+		{&APIStatusError{Code: http.StatusTooManyRequests}, http.StatusBadGateway, false},
+		{fmt.Errorf("season 2023: %w", ErrMaintenance), http.StatusServiceUnavailable, false},
+		{fmt.Errorf("season 2023: %w", ErrEmptyData), http.StatusServiceUnavailable, false},
+		{fmt.Errorf("%w, next attempt in 30s", ErrBackingOff), http.StatusServiceUnavailable, false},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout, false},
+		{fmt.Errorf("something else"), http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		status, hint := buildErrorStatus(tt.err)
+		if status != tt.status {
+			t.Errorf("%v: status %d, want %d", tt.err, status, tt.status)
+		}
+		if got := strings.Contains(hint, "AGSI_API_KEY"); got != tt.keyHint {
+			t.Errorf("%v: hint %q, API key hint %t, want %t", tt.err, hint, got, tt.keyHint)
+		}
+	}
+}
+
+func TestKPIDaysToCritFromLatestDay(t *testing.T) {
+	records := seasonOf(30, -0.5)
+	scenarios, _ := generateScenarios(defaultConfig(), records, nil, 2024, trendWindow)
+	base := buildKPI(defaultConfig(), records, scenarios).DaysToCrit
+
+	// Projecting from three days earlier puts the origin 1.5 points
+	// higher, three more days from critical; the KPI still counts
+	// from the latest gas day.
+	cfg := defaultConfig()
+	cfg.ProjectionOffset = 3
+	scenarios, _ = generateScenarios(cfg, records, nil, 2024, trendWindow)
+	for _, s := range scenarios {
+		if s.Name == "Linear" && s.DaysLeft != base+3 {
+			t.Errorf("Linear days left from origin = %d, want %d", s.DaysLeft, base+3)
+		}
+	}
+	if got := buildKPI(cfg, records, scenarios).DaysToCrit; got != base {
+		t.Errorf("DaysToCrit with offset = %d, want %d", got, base)
+	}
+}
+
+func TestProjectionOffsetCountsProvisionalDays(t *testing.T) {
+	tests := []struct{ offset, provisional, want int }{
+		{3, 0, 3},
+		{3, 2, 1},
+		{2, 3, 0},
+		{0, 3, 0},
+	}
+	for _, tt := range tests {
+		cfg := defaultConfig()
+		cfg.ProjectionOffset, cfg.ProvisionalDays = tt.offset, tt.provisional
+		if got := projectionOffset(cfg); got != tt.want {
+			t.Errorf("offset %d, provisional %d: got %d, want %d",
+				tt.offset, tt.provisional, got, tt.want)
+		}
+	}
+}
+
+func TestCachedSeasonAnchorsAtPivot(t *testing.T) {
+	cal := defaultConfig().Calendar
+	cal.DetectStart, cal.PivotRunDays = true, 3
+	year := cal.CurrentStartYear() - 5
+	// Injection for ten days, withdrawal from day 10 on.
+	records := seasonOf(30, 0)
+	for i := range records {
+		records[i].NetFlow = -1
+		if i < 10 {
+			records[i].NetFlow = 1
+		}
+	}
+	seasonCache.resetIfRolledOver(cal.CurrentStartYear())
+	seasonCache.Set(Facility{}, year, records)
+	defer seasonCache.resetIfRolledOver(0)
+
+	got, ok := cachedSeason(cal, year)
+	if !ok || len(got) != 20 {
+		t.Fatalf("cachedSeason = %d records, %t; want 20 from the pivot", len(got), ok)
+	}
+	if got[0].DaysElapsed != 0 || !got[0].Date.Equal(records[10].Date) {
+		t.Errorf("first record day %d on %s, want day 0 on %s",
+			got[0].DaysElapsed, got[0].Date.Format("2006-01-02"), records[10].Date.Format("2006-01-02"))
+	}
+}
+
+func TestDecodeAPIResponseTruncated(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		truncated bool
+		parse     bool
+	}{
+		{"complete", `{"last_page":1,"data":[{"gasDayStart":"2024-11-01","full":"95"}]}`, false, false},
+		{"cut mid-string", `{"last_page":1,"data":[{"gasDayStart":"2024-`, true, false},
+		{"cut after a record", `{"last_page":1,"data":[{"full":"95"},`, true, false},
+		{"malformed", `{"last_page":1,"data":]}`, false, true},
+	}
+	for _, tt := range tests {
+		_, err := decodeAPIResponse([]byte(tt.body))
+		var parse *ParseError
+		if got := errors.Is(err, ErrTruncated); got != tt.truncated {
+			t.Errorf("%s: ErrTruncated = %t, want %t (%v)", tt.name, got, tt.truncated, err)
+		}
+		if got := errors.As(err, &parse); got != tt.parse {
+			t.Errorf("%s: ParseError = %t, want %t (%v)", tt.name, got, tt.parse, err)
+		}
+		// A cut-off body is worth another attempt, a malformed one is not.
+		if err != nil && retryable(err) != tt.truncated {
+			t.Errorf("%s: retryable = %t, want %t", tt.name, retryable(err), tt.truncated)
+		}
+	}
+}
+
+func TestReadAPIBodyLimit(t *testing.T) {
+	for _, tt := range []struct {
+		limit int
+		err   error
+	}{{10, nil}, {9, ErrTooLarge}} {
+		resp := &http.Response{Body: io.NopCloser(strings.NewReader("0123456789"))}
+		body, err := readAPIBody(resp, tt.limit)
+		if !errors.Is(err, tt.err) || (err == nil && len(body) != 10) {
+			t.Errorf("limit %d: %d bytes, err %v; want err %v", tt.limit, len(body), err, tt.err)
+		}
+	}
+}
+
+func TestCheckJSONBodyMaintenancePage(t *testing.T) {
+	tests := []struct {
+		name, contentType, body string
+		maintenance             bool
+	}{
+		{"json", "application/json", `{"data":[]}`, false},
+		{"html content type", "text/html; charset=utf-8", `<!DOCTYPE html><p>Maintenance</p>`, true},
+		{"html labelled json", "application/json", "\r\n  <html><body>Maintenance</body></html>", true},
+		{"no content type", "", `<html></html>`, true},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+		if tt.contentType != "" {
+			resp.Header.Set("Content-Type", tt.contentType)
+		}
+		err := checkJSONBody(resp, []byte(tt.body))
+		if got := errors.Is(err, ErrMaintenance); got != tt.maintenance {
+			t.Errorf("%s: ErrMaintenance = %t, want %t (%v)", tt.name, got, tt.maintenance, err)
+		}
+		if tt.maintenance && !retryable(err) {
+			t.Errorf("%s: maintenance page should be retryable", tt.name)
+		}
+	}
+}
+
+func TestGenerateScenariosSeasonHorizon(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MaxProjectionDays, cfg.SeasonHorizon = 30, true
+	tests := []struct {
+		name      string
+		slope     float64
+		scenario  bool
+		survives  bool
+		wantPoint float64 // last projected day
+	}{
+		// Critical in ~111 days, before the season ends on day 180:
+		// beyond the 30-day horizon, but not a survivor.
+		{"hit before season end", -0.5, false, false, 0},
+		// Critical in ~204 days, after the season ends.
+		{"survives", -0.3, true, true, 180},
+	}
+	for _, tt := range tests {
+		scenarios, _ := generateScenarios(cfg, seasonOf(30, tt.slope), nil, 2024, trendWindow)
+		var linear *Scenario
+		for i := range scenarios {
+			if scenarios[i].Name == "Linear" {
+				linear = &scenarios[i]
+			}
+		}
+		if (linear != nil) != tt.scenario {
+			t.Errorf("%s: Linear scenario present = %t, want %t", tt.name, linear != nil, tt.scenario)
+			continue
+		}
+		if linear == nil {
+			continue
+		}
+		if linear.SurvivesSeason != tt.survives {
+			t.Errorf("%s: SurvivesSeason = %t, want %t", tt.name, linear.SurvivesSeason, tt.survives)
+		}
+		if last := linear.Points[len(linear.Points)-1]; math.Abs(last.X-tt.wantPoint) > 1 {
+			t.Errorf("%s: projection ends on day %g, want %g", tt.name, last.X, tt.wantPoint)
+		}
+	}
+}
+
+func TestGenerateScenariosProjectToSeasonEnd(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MaxProjectionDays, cfg.ProjectToSeasonEnd = 30, true
+	cfg.StressMultipliers = []float64{1.25}
+
+	// At -0.5/day critical comes on day ~140, before the season ends
+	// on day 180: past the horizon, so nothing is drawn to the end.
+	if scenarios, _ := generateScenarios(cfg, seasonOf(30, -0.5), nil, 2024, trendWindow); len(scenarios) != 0 {
+		t.Errorf("hit before season end: got %d scenarios, want none", len(scenarios))
+	}
+
+	// At -0.2/day both trends stay above critical until the end.
+	scenarios, _ := generateScenarios(cfg, seasonOf(30, -0.2), nil, 2024, trendWindow)
+	if len(scenarios) != 2 {
+		t.Fatalf("got %d scenarios, want Linear and Stress", len(scenarios))
+	}
+	for _, s := range scenarios {
+		if !s.SurvivesSeason || !approx(s.R2, 1) {
+			t.Errorf("%s: SurvivesSeason %t, R² %g; want true, 1", s.Name, s.SurvivesSeason, s.R2)
+		}
+		if last := s.Points[len(s.Points)-1]; math.Abs(last.X-180) > 1 {
+			t.Errorf("%s: projection ends on day %g, want 180", s.Name, last.X)
+		}
+	}
+}
+
+// flakySource fails the first failures calls with err, then serves a
+// single day.
+type flakySource struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakySource) Name() string { return "flaky" }
+
+func (f *flakySource) FetchSeason(ctx context.Context, startYear int, fac Facility) ([]DayRecord, FetchInfo, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, FetchInfo{}, f.err
+	}
+	return seasonOf(1, 0), FetchInfo{}, nil
+}
+
+func TestFetchSeasonWithRetry(t *testing.T) {
+	unavailable := &APIStatusError{Code: http.StatusServiceUnavailable}
+	tests := []struct {
+		name     string
+		src      *flakySource
+		calls    int
+		ok       bool
+		delays   []time.Duration
+		allFails bool
+	}{
+		{"first try", &flakySource{}, 1, true, nil, false},
+		{"last try", &flakySource{failures: 2, err: unavailable}, 3, true,
+			[]time.Duration{retryDelay, 2 * retryDelay}, false},
+		{"all fail", &flakySource{failures: 3, err: unavailable}, 3, false,
+			[]time.Duration{retryDelay, 2 * retryDelay}, true},
+		{"not retryable", &flakySource{failures: 3, err: &APIStatusError{Code: http.StatusUnauthorized}}, 1, false, nil, false},
+	}
+
+	prevSource, prevJitter, prevSleep := activeSource, retryJitter, retrySleep
+	t.Cleanup(func() { activeSource, retryJitter, retrySleep = prevSource, prevJitter, prevSleep })
+	retryJitter = func() float64 { return 0.5 } // backoff without jitter: retryDelay·attempt
+
+	for _, tt := range tests {
+		var delays []time.Duration
+		retrySleep = func(ctx context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		}
+		activeSource = tt.src
+
+		records, info, err := fetchSeasonWithRetry(context.Background(), defaultConfig().Calendar, 2024, Facility{})
+		if tt.ok != (err == nil) || tt.ok != (len(records) == 1) {
+			t.Errorf("%s: %d records, err %v; want ok %t", tt.name, len(records), err, tt.ok)
+		}
+		if tt.src.calls != tt.calls || info.Attempts != tt.calls {
+			t.Errorf("%s: %d calls, %d attempts reported; want %d", tt.name, tt.src.calls, info.Attempts, tt.calls)
+		}
+		if !slices.Equal(delays, tt.delays) {
+			t.Errorf("%s: delays %v, want %v", tt.name, delays, tt.delays)
+		}
+		if got := err != nil && strings.Contains(err.Error(), "all 3 attempts failed"); got != tt.allFails {
+			t.Errorf("%s: error %v, want the all-attempts error %t", tt.name, err, tt.allFails)
+		}
+		if err != nil && !errors.Is(err, tt.src.err) {
+			t.Errorf("%s: error %v does not wrap %v", tt.name, err, tt.src.err)
+		}
+	}
+}
+
+func TestMorePages(t *testing.T) {
+	full := make([]APIRecord, fetchSize)
+	tests := []struct {
+		name string
+		page int
+		resp APIResponse
+		want bool
+	}{
+		{"full page before last_page", 1, APIResponse{LastPage: 2, Data: full}, true},
+		{"last_page reached, data still full", 2, APIResponse{LastPage: 2, Data: full}, false},
+		{"short page before last_page", 1, APIResponse{LastPage: 3, Data: full[:10]}, true},
+		{"full page, no last_page", 1, APIResponse{Data: full}, true},
+		{"short page, no last_page", 1, APIResponse{Data: full[:10]}, false},
+		{"empty page, no last_page", 4, APIResponse{}, false},
+	}
+	for _, tt := range tests {
+		if got := morePages(tt.page, tt.resp); got != tt.want {
+			t.Errorf("%s: morePages = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFetchSeasonsBatchedStopsAtLastPage(t *testing.T) {
+	fastFetches(t)
+	fills := make([]string, fetchSize)
+	for i := range fills {
+		fills[i] = "50"
+	}
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		// Every page is full, so only last_page can end the loop.
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(APIResponse{LastPage: 2, Data: apiDays("2023-11-01", fills...)})
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Source = srv.URL
+	src := newAGSISource(cfg)
+	if _, _, err := fetchSeasonsBatched(context.Background(), src, []int{2023}, Facility{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("%d pages requested, want 2", n)
+	}
+}
+
+func TestFetchSeasonsBatchedFetchInfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		data := append(apiDays("2023-11-01", "80", "79", "78"), apiDays("2022-11-01", "90", "89")...)
+		json.NewEncoder(w).Encode(APIResponse{LastPage: 1, Data: data})
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Source = srv.URL
+	_, infos, err := fetchSeasonsBatched(context.Background(), newAGSISource(cfg), []int{2022, 2023}, Facility{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for year, want := range map[int]int{2022: 2, 2023: 3} {
+		info := infos[year]
+		if info.Source != "batch" || info.RawRecords != want {
+			t.Errorf("%d: source %q, %d raw records; want batch, %d", year, info.Source, info.RawRecords, want)
+		}
+		// The batch took one request for both seasons, so neither
+		// claims its duration as its own.
+		if info.DurationMs != 0 || info.BatchDurationMs < 5 {
+			t.Errorf("%d: durationMs %d, batchDurationMs %d; want 0 and the batch's duration",
+				year, info.DurationMs, info.BatchDurationMs)
+		}
+	}
+}
+
+func TestBusinessTrends(t *testing.T) {
+	// Thursday 7 Nov 2024 to the following Tuesday.
+	records := dayRecords(time.Date(2024, 11, 7, 0, 0, 0, 0, time.UTC), 80, 79, 78.5, 78, 76, 75)
+	businessTrends(records, 0.5)
+	want := []struct{ trend, ma7, ewma float64 }{
+		{0, 0, 0},            // Thu: no previous weekday
+		{-1, -1, -1},         // Fri
+		{0, -1, -1},          // Sat: carried forward
+		{0, -1, -1},          // Sun
+		{-3, -2, -2},         // Mon: against Friday
+		{-1, -5.0 / 3, -1.5}, // Tue
+	}
+	for i, w := range want {
+		r := records[i]
+		if !approx(r.Trend, w.trend) || !approx(r.TrendMA7, w.ma7) || !approx(r.TrendEWMA, w.ewma) {
+			t.Errorf("%s: trend %g, MA7 %g, EWMA %g; want %g, %g, %g", r.Date.Format("Mon 02 Jan"),
+				r.Trend, r.TrendMA7, r.TrendEWMA, w.trend, w.ma7, w.ewma)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string // substring of the error, "" for valid
+	}{
+		{"defaults", func(*Config) {}, ""},
+		{"country", func(c *Config) { c.Country = "DEU" }, "COUNTRY"},
+		{"lower-case country", func(c *Config) { c.Country = "de" }, "COUNTRY"},
+		{"cache ttl", func(c *Config) { c.CacheTTL = 0 }, "CACHE_TTL"},
+		{"critical", func(c *Config) { c.Critical = 100 }, "CRITICAL_THRESHOLD"},
+		{"history", func(c *Config) { c.HistorySeasons = -1 }, "HISTORY_SEASONS"},
+		{"horizon", func(c *Config) { c.MaxProjectionDays = 0 }, "MAX_PROJECTION_DAYS"},
+		{"build timeout", func(c *Config) { c.BuildTimeout = c.HandlerTimeout }, "BUILD_TIMEOUT"},
+		{"share window", func(c *Config) { c.BuildShareWindow = -time.Second }, "BUILD_SHARE_WINDOW"},
+		{"summer window order", func(c *Config) { c.Calendar.SummerStart = c.Calendar.SummerEnd }, "SUMMER_START_MD"},
+		{"summer leap day", func(c *Config) { c.Calendar.SummerEnd = "02-29" }, "SUMMER_END_MD"},
+		{"summer month-day", func(c *Config) { c.Calendar.SummerStart = "4-1" }, "SUMMER_START_MD"},
+		{"target end", func(c *Config) { c.Calendar.TargetEnd = "11-15" }, "TARGET_END_MD"},
+		{"season years", func(c *Config) { c.Calendar.YearMax = c.Calendar.YearMin - 1 }, "SEASON_YEAR_MAX"},
+		{"pivot run", func(c *Config) { c.Calendar.PivotRunDays = 0 }, "PIVOT_RUN_DAYS"},
+		{"response limit", func(c *Config) { c.MaxResponseBytes = 0 }, "MAX_RESPONSE_BYTES"},
+		{"fetch delays", func(c *Config) { c.FetchDelayMax = c.FetchDelayMin / 2 }, "FETCH_DELAY_MIN"},
+		{"build backoff", func(c *Config) { c.BackoffBase = 0 }, "BUILD_BACKOFF_BASE"},
+		{"ewma alpha", func(c *Config) { c.Records.EWMAAlpha = 1.5 }, "EWMA_ALPHA"},
+		{"fill tolerance", func(c *Config) { c.Records.FillTolerance = math.NaN() }, "FILL_TOLERANCE"},
+		{"refill target", func(c *Config) { c.RefillTarget = 0 }, "REFILL_TARGET"},
+		{"no stress multipliers", func(c *Config) { c.StressMultipliers = nil }, "STRESS_MULTIPLIERS"},
+		{"stress multiplier", func(c *Config) { c.StressMultipliers = []float64{0.9, 1.5} }, "STRESS_MULTIPLIERS"},
+		{"min scenario days", func(c *Config) { c.MinScenarioDays = minTrendWindow - 1 }, "MIN_SCENARIO_DAYS"},
+		{"projection offset", func(c *Config) { c.ProjectionOffset = -1 }, "PROJECTION_OFFSET_DAYS"},
+		{"provisional days", func(c *Config) { c.ProvisionalDays = -1 }, "PROVISIONAL_DAYS"},
+		{"r2 threshold", func(c *Config) { c.R2Threshold = 1.5 }, "R2_THRESHOLD"},
+		{"point step", func(c *Config) { c.PointStep = 0 }, "PROJECTION_POINT_STEP"},
+		{"half-life", func(c *Config) { c.HalfLife = -7 }, "REGRESSION_HALF_LIFE"},
+		{"drawdown", func(c *Config) { c.DrawdownPct = 0 }, "RAPID_DRAWDOWN_PCT"},
+		{"webhook", func(c *Config) { c.AlertWebhookURL = "hooks.example.com" }, "ALERT_WEBHOOK_URL"},
+		{"stale after", func(c *Config) { c.StaleAfter = 0 }, "STALE_AFTER"},
+		{"baseline", func(c *Config) { c.BaselineSeasons = -1 }, "BASELINE_SEASONS"},
+		{"even smoothing window", func(c *Config) { c.SmoothWindow = 4 }, "SMOOTH_WINDOW"},
+		{"tick step", func(c *Config) { c.TickStep = 0 }, "TICK_STEP_DAYS"},
+		{"anomaly sigma", func(c *Config) { c.AnomalySigma = 0 }, "ANOMALY_SIGMA"},
+	}
+	for _, tt := range tests {
+		c := defaultConfig()
+		tt.modify(&c)
+		err := c.validate()
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want one about %s", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParsePalette(t *testing.T) {
+	if p, err := parsePalette("Colorblind"); err != nil || p.Current != palettes["colorblind"].Current {
+		t.Errorf("colorblind: %v, %v", p, err)
+	}
+	p, err := parsePalette("#112233, #AABBCC")
+	if err != nil || p.Current != "#112233" || len(p.History) != 1 || p.History[0] != "#aabbcc" {
+		t.Errorf("custom colors: %v, %v", p, err)
+	}
+	for _, v := range []string{"#112233", "#112233,blue", "sepia"} {
+		if _, err := parsePalette(v); err == nil {
+			t.Errorf("%q: want an error", v)
+		}
+	}
+}
+
+func TestEnvParserDate(t *testing.T) {
+	var p envParser
+	var got time.Time
+	t.Setenv("AS_OF", "2024-01-15")
+	p.date("AS_OF", displayLoc, &got)
+	if want := time.Date(2024, 1, 15, 0, 0, 0, 0, displayLoc); len(p.errs) > 0 || !got.Equal(want) {
+		t.Errorf("AS_OF=2024-01-15: %v, %v; want %v", got, p.errs, want)
+	}
+	// A malformed date is an error and leaves the value alone.
+	t.Setenv("AS_OF", "15.01.2024")
+	p.date("AS_OF", displayLoc, &got)
+	if len(p.errs) != 1 || got.Day() != 15 {
+		t.Errorf("AS_OF=15.01.2024: %v, %v; want an error", got, p.errs)
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	unavailable := &APIStatusError{Code: http.StatusServiceUnavailable}
+	state := func(b *CircuitBreaker) string {
+		resp := map[string]interface{}{}
+		b.report(resp)
+		return resp["circuitBreaker"].(map[string]interface{})["state"].(string)
+	}
+
+	// Open after two failures; a 4xx in between resets the count.
+	b := newCircuitBreaker(2, time.Hour)
+	b.Record(unavailable)
+	b.Record(&APIStatusError{Code: http.StatusNotFound})
+	b.Record(unavailable)
+	if got := state(b); got != breakerClosed {
+		t.Fatalf("after non-consecutive failures: %s, want closed", got)
+	}
+	b.Record(unavailable)
+	if got := state(b); got != breakerOpen {
+		t.Fatalf("after 2 consecutive failures: %s, want open", got)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("open breaker allowed a call: %v", err)
+	}
+
+	// Past the cooldown one trial goes out; its failure reopens.
+	b = newCircuitBreaker(1, time.Nanosecond)
+	b.Record(unavailable)
+	time.Sleep(time.Millisecond)
+	if err := b.Allow(); err != nil || state(b) != breakerHalfOpen {
+		t.Fatalf("after cooldown: %v, %s; want a half-open trial", err, state(b))
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second call during the trial: %v, want ErrCircuitOpen", err)
+	}
+	b.Record(unavailable)
+	if got := state(b); got != breakerOpen {
+		t.Fatalf("after a failed trial: %s, want open", got)
+	}
+
+	// A successful trial closes it.
+	time.Sleep(time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.Record(nil)
+	if got := state(b); got != breakerClosed {
+		t.Errorf("after a successful trial: %s, want closed", got)
+	}
+
+	// A threshold of 0 disables the breaker.
+	b = newCircuitBreaker(0, time.Hour)
+	for range 3 {
+		b.Record(unavailable)
+	}
+	if err := b.Allow(); err != nil {
+		t.Errorf("disabled breaker: %v", err)
+	}
+}
+
+func TestBuildGroupSharesFailure(t *testing.T) {
+	errDown := errors.New("upstream down")
+	var builds atomic.Int32
+	release := make(chan struct{})
+	build := func() (*DashboardData, error) {
+		builds.Add(1)
+		<-release
+		return nil, errDown
+	}
+
+	// Waiters that join the build in flight and those arriving after
+	// it failed, within the window, all get its error.
+	g := &BuildGroup{shareWindow: time.Minute}
+	const n = 8
+	var wg sync.WaitGroup
+	var shared atomic.Int32
+	for range n {
+		wg.Go(func() {
+			_, err, s := g.Do(build)
+			if !errors.Is(err, errDown) {
+				t.Errorf("Do: %v, want %v", err, errDown)
+			}
+			if s {
+				shared.Add(1)
+			}
+		})
+	}
+	close(release)
+	wg.Wait()
+	if got := builds.Load(); got != 1 {
+		t.Errorf("%d builds for %d callers, want 1", got, n)
+	}
+	if got := shared.Load(); got != n-1 {
+		t.Errorf("%d callers shared the result, want %d", got, n-1)
+	}
+
+	// Outside the window the next caller builds again.
+	g.shareWindow = 0
+	if _, _, s := g.Do(build); s || builds.Load() != 2 {
+		t.Errorf("after the window: shared %t, %d builds; want a new build", s, builds.Load())
+	}
+}